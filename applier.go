@@ -29,19 +29,25 @@ type Applier struct {
 	commit      *github.Commit
 	tree        string
 	treeCache   map[string]*github.Tree
+	attrCache   map[string]*gitAttributes
 	entries     map[string]*github.TreeEntry
 	uncommitted bool
 
 	applyOptions []gitdiff.ApplyOption
+	match        matchOptions
+	whitespace   WhitespaceMode
+	matches      []FragmentMatch
+	reports      []WhitespaceReport
 }
 
 // NewApplier creates a new Applier for a repository. The Applier applies
 // changes on top of commit c.
 func NewApplier(client *github.Client, repo Repository, c *github.Commit) *Applier {
 	a := &Applier{
-		client: client,
-		owner:  repo.Owner,
-		repo:   repo.Name,
+		client:    client,
+		owner:     repo.Owner,
+		repo:      repo.Name,
+		attrCache: make(map[string]*gitAttributes),
 	}
 	a.Reset(c)
 	return a
@@ -53,10 +59,52 @@ func (a *Applier) SetApplyOptions(opts ...gitdiff.ApplyOption) {
 	a.applyOptions = opts
 }
 
+// SetFuzz enables fuzzy matching of text fragments in modified files. If a
+// fragment does not apply at the line in the patch, Apply searches up to
+// maxOffset lines before and after that line for a match. If the fragment
+// still does not match, Apply ignores up to maxFuzz context lines at the start
+// and the end of the fragment, like the fuzz factor of GNU patch. Setting both
+// values to zero disables fuzzy matching.
+//
+// Use FragmentMatches to find the fragments that did not apply exactly.
+func (a *Applier) SetFuzz(maxOffset, maxFuzz int) {
+	a.match.maxOffset, a.match.maxFuzz = maxOffset, maxFuzz
+}
+
+// SetWhitespace sets how Apply handles whitespace. The mode sets how Apply
+// handles whitespace errors in added lines. If ignoreContext is true, context
+// lines in the patch match lines in the file that differ only in the amount
+// of whitespace, like the --ignore-whitespace option of 'git apply'. The file
+// keeps its whitespace in these lines.
+//
+// Use WhitespaceReports to find the files with whitespace errors or ignored
+// whitespace.
+func (a *Applier) SetWhitespace(mode WhitespaceMode, ignoreContext bool) {
+	a.whitespace = mode
+	a.match.ignoreWhitespace = ignoreContext
+}
+
+// FragmentMatches returns the text fragments applied since the last call to
+// Commit or Reset that applied at a different line or with less context than
+// in the patch.
+func (a *Applier) FragmentMatches() []FragmentMatch {
+	return a.matches
+}
+
+// WhitespaceReports returns a report for each file applied since the last call
+// to Commit or Reset that had whitespace errors or ignored whitespace.
+func (a *Applier) WhitespaceReports() []WhitespaceReport {
+	return a.reports
+}
+
 // Apply applies the changes in a file, adds the result to the list of pending
 // tree entries, and returns the entry. If the application succeeds, Apply
 // creates a blob in the repository with the modified content.
 //
+// Apply ignores the difference between LF and CRLF line endings in the patch
+// and the file. It writes text files, as defined by the .gitattributes files
+// in the tree, with LF and keeps CRLF in other files that only use CRLF.
+//
 // If the apply fails due to a conflict, Apply returns an error of type
 // *Conflict.
 func (a *Applier) Apply(ctx context.Context, f *gitdiff.File) (*github.TreeEntry, error) {
@@ -105,11 +153,22 @@ func (a *Applier) applyCreate(ctx context.Context, f *gitdiff.File) (*github.Tre
 		return nil, &Conflict{Type: ConflictNewFileExists, File: f.NewName}
 	}
 
-	c, err := base64Apply(nil, f.NewName, f, a.applyOptions...)
+	eol, err := detectLineEnding(ctx, f.NewName, nil, f, a.readAttributes)
+	if err != nil {
+		return nil, err
+	}
+
+	adjusted, err := adjustFile(nil, f, f.NewName, eol, a.match, a.whitespace)
 	if err != nil {
 		return nil, err
 	}
 
+	c, err := base64Apply(adjusted, f.NewName, a.applyOptions...)
+	if err != nil {
+		return nil, err
+	}
+	a.addReport(adjusted.report)
+
 	path := f.NewName
 	newEntry := &github.TreeEntry{
 		Path:    &path,
@@ -138,6 +197,12 @@ func (a *Applier) applyDelete(ctx context.Context, f *gitdiff.File) (*github.Tre
 		return nil, fmt.Errorf("get blob content failed: %w", err)
 	}
 
+	eol, err := detectLineEnding(ctx, f.OldName, data, f, a.readAttributes)
+	if err != nil {
+		return nil, err
+	}
+
+	data, f = normalizeLineEndings(data, f, eol)
 	if err := apply(io.Discard, bytes.NewReader(data), f.OldName, f, a.applyOptions...); err != nil {
 		return nil, err
 	}
@@ -174,11 +239,23 @@ func (a *Applier) applyModify(ctx context.Context, f *gitdiff.File) (*github.Tre
 			return nil, fmt.Errorf("get blob content failed: %w", err)
 		}
 
-		c, err := base64Apply(data, f.OldName, f, a.applyOptions...)
+		eol, err := detectLineEnding(ctx, f.NewName, data, f, a.readAttributes)
+		if err != nil {
+			return nil, err
+		}
+
+		adjusted, err := adjustFile(data, f, f.OldName, eol, a.match, a.whitespace)
+		if err != nil {
+			return nil, err
+		}
+
+		c, err := base64Apply(adjusted, f.OldName, a.applyOptions...)
 		if err != nil {
 			return nil, err
 		}
 		newEntry.Content = &c
+		a.matches = append(a.matches, adjusted.matches...)
+		a.addReport(adjusted.report)
 	}
 
 	// delete the old file if it was renamed
@@ -280,6 +357,8 @@ func (a *Applier) Commit(ctx context.Context, tmpl *github.Commit, header *gitdi
 
 	a.commit = commit
 	a.uncommitted = false
+	a.matches = nil
+	a.reports = nil
 	return commit, nil
 }
 
@@ -292,6 +371,14 @@ func (a *Applier) Reset(c *github.Commit) {
 	a.treeCache = make(map[string]*github.Tree)
 	a.entries = make(map[string]*github.TreeEntry)
 	a.uncommitted = false
+	a.matches = nil
+	a.reports = nil
+}
+
+func (a *Applier) addReport(r WhitespaceReport) {
+	if !r.isEmpty() {
+		a.reports = append(a.reports, r)
+	}
 }
 
 // getEntry returns the tree entry for a path. If the path has a pending
@@ -343,6 +430,27 @@ func (a *Applier) getTree(ctx context.Context, sha string) (*github.Tree, error)
 	return tree, nil
 }
 
+// readAttributes reads and parses the .gitattributes file at filePath. It
+// caches parsed files by blob SHA, so the cache remains valid after Reset.
+func (a *Applier) readAttributes(ctx context.Context, filePath string) (*gitAttributes, error) {
+	entry, exists, err := a.getEntry(ctx, filePath)
+	if err != nil || !exists {
+		return nil, err
+	}
+	if attrs, ok := a.attrCache[entry.GetSHA()]; ok {
+		return attrs, nil
+	}
+
+	data, _, err := a.client.Git.GetBlobRaw(ctx, a.owner, a.repo, entry.GetSHA())
+	if err != nil {
+		return nil, fmt.Errorf("get blob content failed: %w", err)
+	}
+
+	attrs := parseGitAttributes(data)
+	a.attrCache[entry.GetSHA()] = attrs
+	return attrs, nil
+}
+
 func findTreeEntry(t *github.Tree, name, entryType string) (*github.TreeEntry, bool) {
 	for _, entry := range t.Entries {
 		if entry.GetPath() == name && entry.GetType() == entryType {
@@ -352,20 +460,52 @@ func findTreeEntry(t *github.Tree, name, entryType string) (*github.TreeEntry, b
 	return nil, false
 }
 
-// base64Apply applies the patch in f to data and returns the result as a
-// base64-encoded string.
-func base64Apply(data []byte, name string, f *gitdiff.File, opts ...gitdiff.ApplyOption) (string, error) {
-	var b bytes.Buffer
+// adjustedFile is a file with text fragments changed to apply to src.
+type adjustedFile struct {
+	src     []byte
+	file    *gitdiff.File
+	eol     lineEnding
+	matches []FragmentMatch
+	report  WhitespaceReport
+}
 
-	enc := base64.NewEncoder(base64.StdEncoding, &b)
-	if err := apply(enc, bytes.NewReader(data), name, f, opts...); err != nil {
-		return "", err
+// adjustFile normalizes the line endings of src and f for eol, changes the
+// text fragments of f so they apply to src with the match options, and fixes
+// whitespace errors with the whitespace mode. The result includes the
+// fragments that moved or needed fuzz and the whitespace errors. If mode is
+// WhitespaceError and the file has errors, adjustFile returns a
+// *BadWhitespaceError.
+func adjustFile(src []byte, f *gitdiff.File, name string, eol lineEnding, match matchOptions, mode WhitespaceMode) (*adjustedFile, error) {
+	src, f = normalizeLineEndings(src, f, eol)
+
+	adjusted, matches, ignored := matchFragments(src, f, match)
+	adjusted, report := checkWhitespace(src, adjusted, name, mode)
+	report.IgnoredContext = ignored
+
+	if mode == WhitespaceError && report.hasErrors() {
+		return nil, &BadWhitespaceError{report}
 	}
-	if err := enc.Close(); err != nil {
-		return "", fmt.Errorf("base64 encoding failed: %w", err)
+	return &adjustedFile{src: src, file: adjusted, eol: eol, matches: matches, report: report}, nil
+}
+
+// apply applies the adjusted file to its source and returns the result with
+// the line endings for the file.
+func (af *adjustedFile) apply(name string, opts ...gitdiff.ApplyOption) ([]byte, error) {
+	var b bytes.Buffer
+	if err := apply(&b, bytes.NewReader(af.src), name, af.file, opts...); err != nil {
+		return nil, err
 	}
+	return convertLineEndings(b.Bytes(), af.eol), nil
+}
 
-	return b.String(), nil
+// base64Apply applies the adjusted file and returns the result as a
+// base64-encoded string.
+func base64Apply(af *adjustedFile, name string, opts ...gitdiff.ApplyOption) (string, error) {
+	data, err := af.apply(name, opts...)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(data), nil
 }
 
 // apply runs gitdiff.Apply, wrapping any conflicts in patch2pr's Conflict type.
@@ -0,0 +1,203 @@
+package patch2pr
+
+import (
+	"context"
+	"path"
+	"strings"
+)
+
+const gitAttributesFile = ".gitattributes"
+
+// attrState is the state of an attribute for a path, as described in
+// gitattributes(5).
+type attrState int
+
+const (
+	attrUnspecified attrState = iota
+	attrSet
+	attrUnset
+	attrValue
+)
+
+type attr struct {
+	name  string
+	state attrState
+	value string
+}
+
+type attrRule struct {
+	pattern []string
+	// anchored is true if the pattern matches paths relative to the
+	// directory of the attributes file instead of file names
+	anchored bool
+	attrs    []attr
+}
+
+// gitAttributes are the rules from one .gitattributes file.
+type gitAttributes struct {
+	rules []attrRule
+}
+
+// parseGitAttributes parses the content of a .gitattributes file. It ignores
+// lines it does not understand, like negative patterns and macro definitions,
+// which Git also ignores in most .gitattributes files.
+func parseGitAttributes(data []byte) *gitAttributes {
+	var attrs gitAttributes
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+
+		pattern := fields[0]
+		if strings.HasPrefix(pattern, "!") || strings.HasPrefix(pattern, "[attr]") || strings.HasSuffix(pattern, "/") {
+			continue
+		}
+
+		rule := attrRule{anchored: strings.Contains(pattern, "/")}
+		rule.pattern = strings.Split(strings.TrimPrefix(pattern, "/"), "/")
+
+		for _, f := range fields[1:] {
+			switch {
+			case f == "binary":
+				// binary is a built-in macro for "-diff -merge -text"
+				rule.attrs = append(rule.attrs, attr{name: "binary", state: attrSet}, attr{name: "text", state: attrUnset})
+			case strings.HasPrefix(f, "-"):
+				rule.attrs = append(rule.attrs, attr{name: f[1:], state: attrUnset})
+			case strings.HasPrefix(f, "!"):
+				rule.attrs = append(rule.attrs, attr{name: f[1:], state: attrUnspecified})
+			default:
+				name, value, ok := strings.Cut(f, "=")
+				if ok {
+					rule.attrs = append(rule.attrs, attr{name: name, state: attrValue, value: value})
+				} else {
+					rule.attrs = append(rule.attrs, attr{name: name, state: attrSet})
+				}
+			}
+		}
+		attrs.rules = append(attrs.rules, rule)
+	}
+	return &attrs
+}
+
+// lookup returns the state of the named attribute for a path relative to the
+// directory of the attributes file. The last matching rule wins. The value is
+// empty unless the state is attrValue.
+func (attrs *gitAttributes) lookup(relPath, name string) (attrState, string, bool) {
+	var a attr
+	var found bool
+	for _, rule := range attrs.rules {
+		if !rule.matches(relPath) {
+			continue
+		}
+		for _, ra := range rule.attrs {
+			if ra.name == name {
+				a, found = ra, true
+			}
+		}
+	}
+	return a.state, a.value, found
+}
+
+func (r attrRule) matches(relPath string) bool {
+	if !r.anchored {
+		return matchSegments(r.pattern, []string{path.Base(relPath)})
+	}
+	return matchSegments(r.pattern, strings.Split(relPath, "/"))
+}
+
+// matchSegments matches the segments of a path against the segments of a
+// pattern. A "**" segment matches any number of segments, a trailing "**"
+// matches at least one, and other segments match like path.Match.
+func matchSegments(pattern, segments []string) bool {
+	if len(pattern) == 0 {
+		return len(segments) == 0
+	}
+	if pattern[0] == "**" {
+		if len(pattern) == 1 {
+			return len(segments) > 0
+		}
+		for i := 0; i <= len(segments); i++ {
+			if matchSegments(pattern[1:], segments[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(segments) == 0 {
+		return false
+	}
+
+	// Git accepts both "[!...]" and "[^...]", but path.Match only uses "^"
+	p := strings.ReplaceAll(pattern[0], "[!", "[^")
+	if ok, err := path.Match(p, segments[0]); err != nil || !ok {
+		return false
+	}
+	return matchSegments(pattern[1:], segments[1:])
+}
+
+// textAttr is the combined effect of the text, eol, and crlf attributes on a
+// path.
+type textAttr int
+
+const (
+	textUnspecified textAttr = iota
+	textSet
+	textUnset
+	textAuto
+)
+
+// attributesReader reads the .gitattributes file at a path. It returns nil if
+// the file does not exist.
+type attributesReader func(ctx context.Context, filePath string) (*gitAttributes, error)
+
+// lookupTextAttr returns the text attribute for filePath using the
+// .gitattributes files in each directory that contains it. Files in deeper
+// directories take precedence. Like Git, a path with an eol attribute is text
+// and the deprecated crlf attribute is used if text is unspecified.
+func lookupTextAttr(ctx context.Context, filePath string, read attributesReader) (textAttr, error) {
+	var text, crlf, eol attr
+
+	dirs := strings.Split(filePath, "/")
+	dirs = dirs[:len(dirs)-1]
+	for i := 0; i <= len(dirs); i++ {
+		dir := strings.Join(dirs[:i], "/")
+
+		attrs, err := read(ctx, path.Join(dir, gitAttributesFile))
+		if err != nil {
+			return textUnspecified, err
+		}
+		if attrs == nil {
+			continue
+		}
+
+		relPath := strings.TrimPrefix(filePath[len(dir):], "/")
+		for name, a := range map[string]*attr{"text": &text, "crlf": &crlf, "eol": &eol} {
+			if state, value, ok := attrs.lookup(relPath, name); ok {
+				*a = attr{name: name, state: state, value: value}
+			}
+		}
+	}
+
+	if text.state == attrUnspecified {
+		text = crlf
+	}
+	switch text.state {
+	case attrSet:
+		return textSet, nil
+	case attrUnset:
+		return textUnset, nil
+	case attrValue:
+		switch {
+		case text.name == "text" && text.value == "auto":
+			return textAuto, nil
+		case text.name == "crlf" && text.value == "input":
+			// crlf=input is the deprecated form of eol=lf
+			return textSet, nil
+		}
+	}
+	if eol.state == attrValue {
+		return textSet, nil
+	}
+	return textUnspecified, nil
+}
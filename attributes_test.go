@@ -0,0 +1,107 @@
+package patch2pr
+
+import (
+	"context"
+	"testing"
+)
+
+func TestLookupTextAttr(t *testing.T) {
+	files := map[string]string{
+		".gitattributes": `# Normalize text files
+* text=auto
+*.bat text eol=crlf
+*.png binary
+/docs/*.txt -text
+legacy/** !text crlf=input
+[attr]custom text
+!negated text
+`,
+		"vendor/.gitattributes": `*.bat -text
+lib/**/*.c text
+[!a]*.h text
+`,
+	}
+
+	read := func(ctx context.Context, filePath string) (*gitAttributes, error) {
+		data, ok := files[filePath]
+		if !ok {
+			return nil, nil
+		}
+		return parseGitAttributes([]byte(data)), nil
+	}
+
+	tests := map[string]textAttr{
+		"README.md":             textAuto,
+		"scripts/build.bat":     textSet,
+		"images/logo.png":       textUnset,
+		"docs/notes.txt":        textUnset,
+		"docs/nested/notes.txt": textAuto,
+		"legacy/src/main.c":     textSet,
+		"vendor/run.bat":        textUnset,
+		"vendor/lib/a/b/x.c":    textSet,
+		"vendor/lib/x.c":        textSet,
+		"vendor/x.c":            textAuto,
+		"vendor/b.h":            textSet,
+		"vendor/a.h":            textAuto,
+		"negated":               textAuto,
+	}
+
+	for path, want := range tests {
+		t.Run(path, func(t *testing.T) {
+			got, err := lookupTextAttr(context.Background(), path, read)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != want {
+				t.Errorf("incorrect text attribute: want %d, got %d", want, got)
+			}
+		})
+	}
+}
+
+func TestLookupTextAttrUnspecified(t *testing.T) {
+	tests := map[string]struct {
+		Attributes string
+		Want       textAttr
+	}{
+		"noRules": {
+			Attributes: "*.bat text\n",
+			Want:       textUnspecified,
+		},
+		"eolImpliesText": {
+			Attributes: "*.txt eol=lf\n",
+			Want:       textSet,
+		},
+		"unsetOverridesEOL": {
+			Attributes: "*.txt -text eol=crlf\n",
+			Want:       textUnset,
+		},
+		"crlfUnset": {
+			Attributes: "*.txt -crlf\n",
+			Want:       textUnset,
+		},
+		"lastRuleWins": {
+			Attributes: "*.txt text\nfile.txt !text\n",
+			Want:       textUnspecified,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			read := func(ctx context.Context, filePath string) (*gitAttributes, error) {
+				if filePath != gitAttributesFile {
+					return nil, nil
+				}
+				return parseGitAttributes([]byte(test.Attributes)), nil
+			}
+
+			got, err := lookupTextAttr(context.Background(), "file.txt", read)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != test.Want {
+				t.Errorf("incorrect text attribute: want %d, got %d", test.Want, got)
+			}
+		})
+	}
+}
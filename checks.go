@@ -0,0 +1,178 @@
+package patch2pr
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/go-github/v89/github"
+)
+
+// CheckState is the summarized state of a commit status or check run.
+type CheckState string
+
+const (
+	// CheckPending indicates the check has not finished.
+	CheckPending CheckState = "pending"
+
+	// CheckSuccess indicates the check passed, was neutral, or was skipped.
+	CheckSuccess CheckState = "success"
+
+	// CheckFailure indicates the check failed, errored, was cancelled, or
+	// requires action.
+	CheckFailure CheckState = "failure"
+)
+
+// Check is a single commit status or check run.
+type Check struct {
+	Name  string
+	State CheckState
+	// The state or conclusion reported by GitHub, like "error" or "timed_out".
+	Detail string
+	URL    string
+}
+
+// CheckResults contains the commit statuses and check runs for a commit.
+type CheckResults struct {
+	SHA    string
+	State  CheckState
+	Checks []Check
+}
+
+// GetChecks returns the commit statuses and check runs for the commit sha in
+// repo. The overall state is pending if any check is pending or if there are
+// no checks. Otherwise, it is failure if any check failed and success if all
+// checks passed.
+func GetChecks(ctx context.Context, client *github.Client, repo Repository, sha string) (*CheckResults, error) {
+	res := &CheckResults{SHA: sha}
+
+	statusOpts := &github.ListOptions{PerPage: 100}
+	for {
+		combined, r, err := client.Repositories.GetCombinedStatus(ctx, repo.Owner, repo.Name, sha, statusOpts)
+		if err != nil {
+			return nil, fmt.Errorf("get combined status failed: %w", err)
+		}
+		for _, s := range combined.Statuses {
+			res.Checks = append(res.Checks, Check{
+				Name:   s.GetContext(),
+				State:  statusState(s.GetState()),
+				Detail: s.GetState(),
+				URL:    s.GetTargetURL(),
+			})
+		}
+		if r.NextPage == 0 {
+			break
+		}
+		statusOpts.Page = r.NextPage
+	}
+
+	runOpts := &github.ListCheckRunsOptions{ListOptions: github.ListOptions{PerPage: 100}}
+	for {
+		runs, r, err := client.Checks.ListCheckRunsForRef(ctx, repo.Owner, repo.Name, sha, runOpts)
+		if err != nil {
+			return nil, fmt.Errorf("list check runs failed: %w", err)
+		}
+		for _, run := range runs.CheckRuns {
+			detail := run.GetConclusion()
+			if detail == "" {
+				detail = run.GetStatus()
+			}
+			res.Checks = append(res.Checks, Check{
+				Name:   run.GetName(),
+				State:  checkRunState(run.GetStatus(), run.GetConclusion()),
+				Detail: detail,
+				URL:    run.GetHTMLURL(),
+			})
+		}
+		if r.NextPage == 0 {
+			break
+		}
+		runOpts.Page = r.NextPage
+	}
+
+	res.State = combineCheckStates(res.Checks)
+	return res, nil
+}
+
+// WaitForChecks calls GetChecks every interval until the overall state is not
+// pending. Use a context with a deadline to limit the total wait time. If the
+// context ends first, WaitForChecks returns the latest results and the
+// context's error.
+//
+// Checks may not be reported until some time after a commit is pushed, so
+// having no checks is pending. If grace is positive and there are still no
+// checks after grace, WaitForChecks assumes the repository has no checks and
+// returns results with the state CheckSuccess.
+func WaitForChecks(ctx context.Context, client *github.Client, repo Repository, sha string, interval, grace time.Duration) (*CheckResults, error) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	start := time.Now()
+
+	var latest *CheckResults
+	for {
+		res, err := GetChecks(ctx, client, repo, sha)
+		if err != nil {
+			if ctx.Err() != nil {
+				return latest, ctx.Err()
+			}
+			return nil, err
+		}
+		latest = res
+
+		if res.State != CheckPending {
+			return res, nil
+		}
+		if len(res.Checks) == 0 && grace > 0 && time.Since(start) >= grace {
+			res.State = CheckSuccess
+			return res, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return latest, ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+func statusState(state string) CheckState {
+	switch state {
+	case "success":
+		return CheckSuccess
+	case "failure", "error":
+		return CheckFailure
+	}
+	return CheckPending
+}
+
+func checkRunState(status, conclusion string) CheckState {
+	if status != "completed" {
+		return CheckPending
+	}
+	switch conclusion {
+	case "success", "neutral", "skipped":
+		return CheckSuccess
+	}
+	return CheckFailure
+}
+
+func combineCheckStates(checks []Check) CheckState {
+	if len(checks) == 0 {
+		// Checks may not be reported until some time after a commit is pushed
+		return CheckPending
+	}
+
+	state := CheckSuccess
+	for _, c := range checks {
+		switch c.State {
+		case CheckPending:
+			state = CheckPending
+		case CheckFailure:
+			if state != CheckPending {
+				state = CheckFailure
+			}
+		}
+	}
+	return state
+}
@@ -0,0 +1,132 @@
+package patch2pr
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v89/github"
+)
+
+func TestCheckRunState(t *testing.T) {
+	tests := []struct {
+		Status     string
+		Conclusion string
+		State      CheckState
+	}{
+		{"queued", "", CheckPending},
+		{"in_progress", "", CheckPending},
+		{"completed", "success", CheckSuccess},
+		{"completed", "neutral", CheckSuccess},
+		{"completed", "skipped", CheckSuccess},
+		{"completed", "failure", CheckFailure},
+		{"completed", "timed_out", CheckFailure},
+		{"completed", "action_required", CheckFailure},
+	}
+
+	for _, test := range tests {
+		if got := checkRunState(test.Status, test.Conclusion); got != test.State {
+			t.Errorf("%s/%s: expected %s, got %s", test.Status, test.Conclusion, test.State, got)
+		}
+	}
+}
+
+func TestCombineCheckStates(t *testing.T) {
+	tests := map[string]struct {
+		States []CheckState
+		State  CheckState
+	}{
+		"empty":          {nil, CheckPending},
+		"allSuccess":     {[]CheckState{CheckSuccess, CheckSuccess}, CheckSuccess},
+		"failure":        {[]CheckState{CheckSuccess, CheckFailure}, CheckFailure},
+		"pending":        {[]CheckState{CheckSuccess, CheckPending}, CheckPending},
+		"failureFirst":   {[]CheckState{CheckFailure, CheckPending}, CheckPending},
+		"failureLast":    {[]CheckState{CheckPending, CheckFailure}, CheckPending},
+		"statusFailures": {[]CheckState{statusState("error"), statusState("success")}, CheckFailure},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			checks := make([]Check, len(test.States))
+			for i, s := range test.States {
+				checks[i] = Check{Name: "check", State: s}
+			}
+			if got := combineCheckStates(checks); got != test.State {
+				t.Errorf("expected %s, got %s", test.State, got)
+			}
+		})
+	}
+}
+
+func TestWaitForChecks(t *testing.T) {
+	tests := map[string]struct {
+		// The number of requests before the check run is reported, or -1 if
+		// it is never reported
+		ReportAfter int
+		Grace       time.Duration
+		State       CheckState
+		Checks      int
+		Err         error
+	}{
+		"noChecks": {
+			ReportAfter: -1,
+			Grace:       20 * time.Millisecond,
+			State:       CheckSuccess,
+		},
+		"noChecksWithoutGrace": {
+			ReportAfter: -1,
+			State:       CheckPending,
+			Err:         context.DeadlineExceeded,
+		},
+		"lateCheck": {
+			ReportAfter: 2,
+			Grace:       time.Hour,
+			State:       CheckSuccess,
+			Checks:      1,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			var requests atomic.Int32
+			mux := http.NewServeMux()
+			mux.HandleFunc("/repos/o/r/commits/abc/status", func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprint(w, `{"state": "pending", "statuses": []}`)
+			})
+			mux.HandleFunc("/repos/o/r/commits/abc/check-runs", func(w http.ResponseWriter, r *http.Request) {
+				n := int(requests.Add(1))
+				if test.ReportAfter < 0 || n <= test.ReportAfter {
+					fmt.Fprint(w, `{"total_count": 0, "check_runs": []}`)
+					return
+				}
+				fmt.Fprint(w, `{"total_count": 1, "check_runs": [{"name": "build", "status": "completed", "conclusion": "success"}]}`)
+			})
+
+			srv := httptest.NewServer(mux)
+			defer srv.Close()
+
+			client, err := github.NewClient(github.WithURLs(github.Ptr(srv.URL+"/"), nil))
+			if err != nil {
+				t.Fatalf("unexpected error creating client: %v", err)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+			defer cancel()
+
+			res, err := WaitForChecks(ctx, client, Repository{Owner: "o", Name: "r"}, "abc", time.Millisecond, test.Grace)
+			if err != test.Err {
+				t.Fatalf("incorrect error: expected %v, got %v", test.Err, err)
+			}
+			if res.State != test.State {
+				t.Errorf("incorrect state: expected %s, got %s", test.State, res.State)
+			}
+			if len(res.Checks) != test.Checks {
+				t.Errorf("incorrect number of checks: expected %d, got %d", test.Checks, len(res.Checks))
+			}
+		})
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"slices"
+	"strings"
+)
+
+const (
+	// maxDecompressedBytes limits the size of decompressed input to protect
+	// against inputs that expand to use all available memory
+	maxDecompressedBytes = 256 << 20
+
+	// maxArchiveEntries limits the number of files read from a tar archive
+	maxArchiveEntries = 10000
+
+	tarMagicOffset = 257
+	tarBlockSize   = 512
+)
+
+var (
+	gzipMagic  = []byte{0x1f, 0x8b}
+	bzip2Magic = []byte("BZh")
+	tarMagic   = []byte("ustar")
+)
+
+// errInputTooLarge is returned when decompressed input exceeds the limit.
+var errInputTooLarge = fmt.Errorf("decompressed input is larger than %d bytes", maxDecompressedBytes)
+
+// decompress returns a reader for the decompressed content of r if r starts
+// with a gzip or bzip2 header. Otherwise, it returns a reader for the
+// unmodified content of r. The decompressed content is limited to
+// maxDecompressedBytes.
+func decompress(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(r)
+
+	magic, err := br.Peek(len(bzip2Magic) + 1)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, fmt.Errorf("read gzip input failed: %w", err)
+		}
+		return &limitReader{r: zr, n: maxDecompressedBytes}, nil
+
+	case bytes.HasPrefix(magic, bzip2Magic) && len(magic) > len(bzip2Magic) && '1' <= magic[3] && magic[3] <= '9':
+		return &limitReader{r: bzip2.NewReader(br), n: maxDecompressedBytes}, nil
+	}
+	return br, nil
+}
+
+// isTar returns true if the content of br starts with a tar header.
+func isTar(br *bufio.Reader) bool {
+	header, _ := br.Peek(tarBlockSize)
+	return len(header) == tarBlockSize && bytes.HasPrefix(header[tarMagicOffset:], tarMagic)
+}
+
+type archiveEntry struct {
+	name    string
+	content []byte
+}
+
+// readTar returns the patch files in a tar archive, ordered by the number at
+// the start of each file name, like the output of 'git format-patch'. Entries
+// may be compressed, but are not expanded if they are also archives.
+func readTar(r io.Reader) ([]archiveEntry, error) {
+	var entries []archiveEntry
+	var total int64
+
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read tar archive failed: %w", err)
+		}
+
+		base := path.Base(hdr.Name)
+		if hdr.Typeflag != tar.TypeReg || strings.HasPrefix(base, ".") || !isPatchFileName(base) {
+			continue
+		}
+		if len(entries) >= maxArchiveEntries {
+			return nil, fmt.Errorf("tar archive contains more than %d patch files", maxArchiveEntries)
+		}
+
+		er, err := decompress(tr)
+		if err != nil {
+			return nil, fmt.Errorf("read %s failed: %w", hdr.Name, err)
+		}
+
+		content, err := io.ReadAll(&limitReader{r: er, n: maxDecompressedBytes - total})
+		if err != nil {
+			return nil, fmt.Errorf("read %s failed: %w", hdr.Name, err)
+		}
+		total += int64(len(content))
+
+		entries = append(entries, archiveEntry{name: hdr.Name, content: content})
+	}
+
+	slices.SortStableFunc(entries, func(a, b archiveEntry) int {
+		return compareNumericPrefix(path.Base(a.name), path.Base(b.name))
+	})
+	return entries, nil
+}
+
+// isPatchFileName returns true if name has a patch file extension, optionally
+// followed by a compression extension.
+func isPatchFileName(name string) bool {
+	name = strings.ToLower(name)
+	for _, ext := range []string{".gz", ".bz2"} {
+		name = strings.TrimSuffix(name, ext)
+	}
+	return slices.Contains(patchFileExts, path.Ext(name))
+}
+
+// limitReader is like io.LimitedReader, but returns errInputTooLarge instead
+// of io.EOF if the underlying reader has more than n bytes.
+type limitReader struct {
+	r io.Reader
+	n int64
+}
+
+func (lr *limitReader) Read(p []byte) (int, error) {
+	if lr.n <= 0 {
+		// Check if there is more data without returning it
+		var b [1]byte
+		if n, err := lr.r.Read(b[:]); n > 0 {
+			return 0, errInputTooLarge
+		} else if err != nil {
+			return 0, err
+		}
+		return 0, nil
+	}
+
+	if int64(len(p)) > lr.n {
+		p = p[:lr.n]
+	}
+	n, err := lr.r.Read(p)
+	lr.n -= int64(n)
+	return n, err
+}
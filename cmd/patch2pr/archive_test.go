@@ -0,0 +1,134 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseCompressed(t *testing.T) {
+	patch, err := os.ReadFile("testdata/cover.mbox")
+	if err != nil {
+		t.Fatalf("error reading file: %v", err)
+	}
+
+	dir := t.TempDir()
+	gzFile := filepath.Join(dir, "cover.mbox.gz")
+	if err := os.WriteFile(gzFile, gzipBytes(t, patch), 0o644); err != nil {
+		t.Fatalf("error writing file: %v", err)
+	}
+
+	for _, tc := range []struct {
+		File  string
+		Title string
+	}{
+		{File: gzFile, Title: "Say hello to everyone"},
+		{File: "testdata/hello.patch.bz2", Title: "Say hello"},
+	} {
+		t.Run(filepath.Base(tc.File), func(t *testing.T) {
+			patches, err := parse(tc.File, parseOptions{})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(patches) == 0 {
+				t.Fatal("expected patches, but got none")
+			}
+
+			last := patches[len(patches)-1]
+			if len(last.files) != 1 {
+				t.Errorf("incorrect number of files: expected 1, actual %d", len(last.files))
+			}
+			if last.header == nil || last.header.Title != tc.Title {
+				t.Errorf("incorrect header: expected title %q, actual %+v", tc.Title, last.header)
+			}
+		})
+	}
+}
+
+func TestParseTar(t *testing.T) {
+	patch := func(title string) []byte {
+		return []byte("From 5255ca3071e33871ad7c23de1a3962f19b215f74 Mon Sep 17 00:00:00 2001\n" +
+			"From: Test <test@example.com>\n" +
+			"Subject: [PATCH] " + title + "\n" +
+			"\n" +
+			"---\n" + testPatchDiff)
+	}
+
+	var b bytes.Buffer
+	tw := tar.NewWriter(&b)
+	writeTarFile(t, tw, "series/0002-second.patch", patch("Second"))
+	writeTarFile(t, tw, "series/README", []byte("not a patch"))
+	writeTarFile(t, tw, "series/0001-first.patch.gz", gzipBytes(t, patch("First")))
+	writeTarFile(t, tw, "series/0010-tenth.patch", patch("Tenth"))
+	if err := tw.Close(); err != nil {
+		t.Fatalf("error closing tar: %v", err)
+	}
+
+	file := filepath.Join(t.TempDir(), "series.tar.gz")
+	if err := os.WriteFile(file, gzipBytes(t, b.Bytes()), 0o644); err != nil {
+		t.Fatalf("error writing file: %v", err)
+	}
+
+	patches, err := parse(file, parseOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var titles, sources []string
+	for _, p := range patches {
+		titles = append(titles, p.header.Title)
+		sources = append(sources, strings.TrimPrefix(p.path, file+":"))
+	}
+
+	if expected := []string{"First", "Second", "Tenth"}; !reflect.DeepEqual(expected, titles) {
+		t.Errorf("incorrect titles: expected %q, actual %q", expected, titles)
+	}
+	if expected := []string{"series/0001-first.patch.gz", "series/0002-second.patch", "series/0010-tenth.patch"}; !reflect.DeepEqual(expected, sources) {
+		t.Errorf("incorrect sources: expected %q, actual %q", expected, sources)
+	}
+}
+
+func TestLimitReader(t *testing.T) {
+	b, err := io.ReadAll(&limitReader{r: strings.NewReader("12345"), n: 5})
+	if err != nil || string(b) != "12345" {
+		t.Errorf("expected full content without error, actual %q and %v", b, err)
+	}
+
+	_, err = io.ReadAll(&limitReader{r: strings.NewReader("123456"), n: 5})
+	if !errors.Is(err, errInputTooLarge) {
+		t.Errorf("incorrect error: expected errInputTooLarge, actual %v", err)
+	}
+}
+
+func gzipBytes(t *testing.T, b []byte) []byte {
+	var out bytes.Buffer
+	zw := gzip.NewWriter(&out)
+	if _, err := zw.Write(b); err != nil {
+		t.Fatalf("error compressing data: %v", err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("error compressing data: %v", err)
+	}
+	return out.Bytes()
+}
+
+func writeTarFile(t *testing.T, tw *tar.Writer, name string, content []byte) {
+	if err := tw.WriteHeader(&tar.Header{
+		Name:     name,
+		Mode:     0o644,
+		Size:     int64(len(content)),
+		Typeflag: tar.TypeReg,
+	}); err != nil {
+		t.Fatalf("error writing tar header: %v", err)
+	}
+	if _, err := tw.Write(content); err != nil {
+		t.Fatalf("error writing tar content: %v", err)
+	}
+}
@@ -0,0 +1,347 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"path"
+	"strings"
+
+	"golang.org/x/text/encoding/htmlindex"
+)
+
+// decodeMessage decodes an email message so that its headers and body are
+// plain text that gitdiff can parse. It handles RFC 2047 encoded headers,
+// quoted-printable and base64 transfer encodings, non-UTF-8 charsets, and
+// multipart messages with patch attachments. Only the headers and the text
+// before the diff are converted to UTF-8.
+//
+// If an attachment is a complete patch email, like the output of 'git
+// format-patch', each such attachment is returned as a separate message.
+// Otherwise, it returns a single message. Input that is not an email or
+// does not use any encoding is returned unchanged.
+func decodeMessage(raw []byte) ([][]byte, error) {
+	var postmark []byte
+	content := raw
+	if i := bytes.IndexByte(raw, '\n'); i >= 0 && isFromLine(raw[:i+1]) {
+		postmark, content = raw[:i+1], raw[i+1:]
+	}
+
+	msg, err := mail.ReadMessage(bytes.NewReader(content))
+	if err != nil || !needsDecoding(msg.Header) {
+		return [][]byte{raw}, nil
+	}
+
+	text, attachments, err := decodePart(textproto.MIMEHeader(msg.Header), msg.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var messages [][]byte
+	for _, a := range attachments {
+		if isPatchEmail(a) {
+			decoded, err := decodeMessage(a)
+			if err != nil {
+				return nil, err
+			}
+			messages = append(messages, decoded...)
+		}
+	}
+	if len(messages) > 0 {
+		return messages, nil
+	}
+
+	var b bytes.Buffer
+	b.Write(postmark)
+	if err := writeDecodedHeaders(&b, msg.Header); err != nil {
+		return nil, err
+	}
+	b.WriteString("\n")
+	b.WriteString(text)
+	for _, a := range attachments {
+		if b.Len() > 0 && b.Bytes()[b.Len()-1] != '\n' {
+			b.WriteString("\n")
+		}
+		b.Write(a)
+	}
+	return [][]byte{b.Bytes()}, nil
+}
+
+// needsDecoding returns true if a message uses MIME features that gitdiff
+// does not handle itself.
+func needsDecoding(h mail.Header) bool {
+	if strings.Contains(h.Get("Subject"), "=?") || strings.Contains(h.Get("From"), "=?") {
+		return true
+	}
+	if from := h.Get("From"); !strings.Contains(from, "@") && strings.Contains(from, " at ") {
+		return true
+	}
+
+	switch strings.ToLower(strings.TrimSpace(h.Get("Content-Transfer-Encoding"))) {
+	case "", "7bit", "8bit", "binary":
+	default:
+		return true
+	}
+
+	mediaType, params, err := mime.ParseMediaType(h.Get("Content-Type"))
+	if err != nil {
+		return false
+	}
+	if strings.HasPrefix(mediaType, "multipart/") {
+		return true
+	}
+	return !isUTF8Charset(params["charset"])
+}
+
+// decodePart returns the text of a message part and the content of any patch
+// attachments it contains.
+func decodePart(h textproto.MIMEHeader, body io.Reader) (text string, attachments [][]byte, err error) {
+	mediaType, params, err := mime.ParseMediaType(h.Get("Content-Type"))
+	if err != nil {
+		mediaType, params = "text/plain", nil
+	}
+
+	body, err = transferDecoder(h.Get("Content-Transfer-Encoding"), body)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		return decodeMultipart(mediaType, params["boundary"], body)
+	}
+
+	content, err := io.ReadAll(body)
+	if err != nil {
+		return "", nil, fmt.Errorf("read message body failed: %w", err)
+	}
+	if content, err = decodeText(params["charset"], content); err != nil {
+		return "", nil, err
+	}
+
+	if isPatchAttachment(h, mediaType, content) {
+		return "", [][]byte{content}, nil
+	}
+	if strings.HasPrefix(mediaType, "text/") {
+		return string(content), nil, nil
+	}
+	return "", nil, nil
+}
+
+func decodeMultipart(mediaType, boundary string, body io.Reader) (text string, attachments [][]byte, err error) {
+	if boundary == "" {
+		return "", nil, fmt.Errorf("%s message has no boundary", mediaType)
+	}
+
+	var texts []string
+	mr := multipart.NewReader(body, boundary)
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", nil, fmt.Errorf("read %s message failed: %w", mediaType, err)
+		}
+
+		partText, partAttachments, err := decodePart(part.Header, part)
+		if err != nil {
+			return "", nil, err
+		}
+		attachments = append(attachments, partAttachments...)
+
+		partType, _, _ := mime.ParseMediaType(part.Header.Get("Content-Type"))
+		if partText != "" && (partType == "" || partType == "text/plain") {
+			texts = append(texts, partText)
+		}
+	}
+
+	// Alternative parts contain the same text in different formats
+	if mediaType == "multipart/alternative" && len(texts) > 1 {
+		texts = texts[:1]
+	}
+	return strings.Join(texts, "\n"), attachments, nil
+}
+
+func transferDecoder(encoding string, r io.Reader) (io.Reader, error) {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "", "7bit", "8bit", "binary":
+		return r, nil
+	case "quoted-printable":
+		return quotedprintable.NewReader(r), nil
+	case "base64":
+		return base64.NewDecoder(base64.StdEncoding, r), nil
+	}
+	return nil, fmt.Errorf("unsupported content transfer encoding %q", encoding)
+}
+
+// decodeText converts the text before the first diff in content from charset
+// to UTF-8. Like 'git mailinfo', it does not convert the diff, which must
+// match the bytes of the files it changes.
+func decodeText(charset string, content []byte) ([]byte, error) {
+	if isUTF8Charset(charset) {
+		return content, nil
+	}
+
+	text, diff := content, []byte(nil)
+	if i := diffStart(content); i >= 0 {
+		text, diff = content[:i], content[i:]
+	}
+
+	cr, err := charsetReader(charset, bytes.NewReader(text))
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := io.ReadAll(cr)
+	if err != nil {
+		return nil, fmt.Errorf("decode message body failed: %w", err)
+	}
+	return append(b, diff...), nil
+}
+
+// diffStart returns the offset of the first line of the first diff in
+// content or -1 if content does not contain a diff.
+func diffStart(content []byte) int {
+	var offset int
+	var prev []byte
+	for line := range bytes.Lines(content) {
+		switch {
+		case bytes.HasPrefix(line, []byte("diff ")), bytes.HasPrefix(line, []byte("Index: ")):
+			return offset
+		case bytes.HasPrefix(line, []byte("+++ ")) && bytes.HasPrefix(prev, []byte("--- ")):
+			return offset - len(prev)
+		}
+		offset += len(line)
+		prev = line
+	}
+	return -1
+}
+
+func charsetReader(charset string, r io.Reader) (io.Reader, error) {
+	if isUTF8Charset(charset) {
+		return r, nil
+	}
+
+	enc, err := htmlindex.Get(charset)
+	if err != nil {
+		return nil, fmt.Errorf("unsupported charset %q", charset)
+	}
+	return enc.NewDecoder().Reader(r), nil
+}
+
+func isUTF8Charset(charset string) bool {
+	switch strings.ToLower(strings.TrimSpace(charset)) {
+	case "", "utf-8", "utf8", "us-ascii", "ascii":
+		return true
+	}
+	return false
+}
+
+var patchMediaTypes = map[string]bool{
+	"text/x-patch":        true,
+	"text/x-diff":         true,
+	"text/x-patch-series": true,
+	"application/x-patch": true,
+	"text/diff":           true,
+	"text/patch":          true,
+}
+
+// isPatchAttachment returns true if a message part contains a patch that is
+// separate from the message text.
+func isPatchAttachment(h textproto.MIMEHeader, mediaType string, content []byte) bool {
+	if patchMediaTypes[mediaType] {
+		return true
+	}
+
+	disposition, params, _ := mime.ParseMediaType(h.Get("Content-Disposition"))
+	if disposition != "attachment" {
+		return false
+	}
+
+	switch path.Ext(params["filename"]) {
+	case ".patch", ".diff":
+		return true
+	}
+	return mediaType == "text/plain" && (bytes.HasPrefix(content, []byte("diff ")) || bytes.Contains(content, []byte("\ndiff --git ")))
+}
+
+// isPatchEmail returns true if an attachment is a complete email with a patch,
+// like a file created by 'git format-patch'.
+func isPatchEmail(b []byte) bool {
+	if i := bytes.IndexByte(b, '\n'); i >= 0 && isFromLine(b[:i+1]) {
+		return true
+	}
+	msg, err := mail.ReadMessage(bytes.NewReader(b))
+	return err == nil && msg.Header.Get("Subject") != "" && msg.Header.Get("From") != ""
+}
+
+// writeDecodedHeaders writes the headers used by gitdiff with any RFC 2047
+// encoded words decoded to UTF-8.
+func writeDecodedHeaders(w io.Writer, h mail.Header) error {
+	dec := &mime.WordDecoder{CharsetReader: charsetReader}
+
+	if from := h.Get("From"); from != "" {
+		decoded, err := decodeFrom(dec, from)
+		if err != nil {
+			return fmt.Errorf("invalid From header: %w", err)
+		}
+		fmt.Fprintf(w, "From: %s\n", decoded)
+	}
+	if date := h.Get("Date"); date != "" {
+		fmt.Fprintf(w, "Date: %s\n", date)
+	}
+	if subject := h.Get("Subject"); subject != "" {
+		decoded, err := dec.DecodeHeader(subject)
+		if err != nil {
+			return fmt.Errorf("invalid Subject header: %w", err)
+		}
+		fmt.Fprintf(w, "Subject: %s\n", decoded)
+	}
+	return nil
+}
+
+// decodeFrom decodes a From header. Mailing list archives often obfuscate
+// addresses, like "jdoe at example.com (John Doe)", so if the header is not a
+// valid address and has no "@", decodeFrom replaces the first " at " before
+// parsing. If the header is still not a valid address, decodeFrom returns the
+// original header with only encoded words decoded.
+func decodeFrom(dec *mime.WordDecoder, from string) (string, error) {
+	parser := mail.AddressParser{WordDecoder: dec}
+
+	addr, err := parser.Parse(from)
+	if err != nil && !strings.Contains(from, "@") {
+		addr, err = parser.Parse(strings.Replace(from, " at ", "@", 1))
+	}
+	if err != nil {
+		return dec.DecodeHeader(from)
+	}
+	if addr.Name == "" {
+		return addr.Address, nil
+	}
+	return fmt.Sprintf("%s <%s>", quoteDisplayName(addr.Name), addr.Address), nil
+}
+
+// quoteDisplayName quotes a display name that contains special characters,
+// like the comma in "Doe, John". Unlike mail.Address.String, it does not
+// encode names with non-ASCII characters.
+func quoteDisplayName(name string) string {
+	if !strings.ContainsAny(name, `"(),.:;<>@[\]`) {
+		return name
+	}
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, c := range name {
+		if c == '"' || c == '\\' {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(c)
+	}
+	b.WriteByte('"')
+	return b.String()
+}
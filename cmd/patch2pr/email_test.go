@@ -0,0 +1,264 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/bluekeyes/go-gitdiff/gitdiff"
+)
+
+const testPatchDiff = `diff --git a/hello.txt b/hello.txt
+index ce01362..dcbe6e3 100644
+--- a/hello.txt
++++ b/hello.txt
+@@ -1 +1 @@
+-hello
++hello, everyone
+`
+
+func TestDecodeMessage(t *testing.T) {
+	tests := map[string]struct {
+		Input     string
+		Count     int
+		Author    string
+		Title     string
+		Body      string
+		Unchanged bool
+	}{
+		"plain": {
+			Input: "From 5255ca3071e33871ad7c23de1a3962f19b215f74 Mon Sep 17 00:00:00 2001\n" +
+				"From: Test <test@example.com>\n" +
+				"Subject: [PATCH] Say hello\n" +
+				"\n" +
+				"---\n" + testPatchDiff,
+			Unchanged: true,
+			Author:    "Test",
+			Title:     "Say hello",
+		},
+		"notEmail": {
+			Input:     testPatchDiff,
+			Unchanged: true,
+		},
+		"encodedHeaders": {
+			Input: "From: =?ISO-8859-1?Q?J=F6rg_M=FCller?= <jorg@example.com>\n" +
+				"Subject: =?UTF-8?B?W1BBVENIXSBTYXkgaGVsbG8g8J+Riw==?=\n" +
+				"\n" +
+				"---\n" + testPatchDiff,
+			Author: "Jörg Müller",
+			Title:  "Say hello 👋",
+		},
+		"obfuscatedFrom": {
+			Input: "From: jdoe at example.com (John Doe)\n" +
+				"Subject: [PATCH] Say hello\n" +
+				"\n" +
+				"---\n" + testPatchDiff,
+			Author: "John Doe",
+			Title:  "Say hello",
+		},
+		"invalidFrom": {
+			Input: "From: John Doe <jdoe@example.com\n" +
+				"Subject: =?UTF-8?Q?[PATCH]_Say_hello?=\n" +
+				"\n" +
+				"---\n" + testPatchDiff,
+			Author: "John Doe",
+			Title:  "Say hello",
+		},
+		"quotedDisplayName": {
+			Input: "From: =?UTF-8?Q?Doe=2C_J=C3=B6rg?= <jdoe@example.com>\n" +
+				"Subject: [PATCH] Say hello\n" +
+				"\n" +
+				"---\n" + testPatchDiff,
+			Author: "Doe, Jörg",
+			Title:  "Say hello",
+		},
+		"quotedPrintable": {
+			Input: "From: Test <test@example.com>\n" +
+				"Subject: [PATCH] Say hello\n" +
+				"Content-Type: text/plain; charset=iso-8859-1\n" +
+				"Content-Transfer-Encoding: quoted-printable\n" +
+				"\n" +
+				"Caf=E9 greetings are a long line that is wrapped by the quoted-printable =\n" +
+				"encoding.\n" +
+				"---\n" + strings.ReplaceAll(testPatchDiff, "=", "=3D"),
+			Author: "Test",
+			Title:  "Say hello",
+			Body:   "Café greetings are a long line that is wrapped by the quoted-printable encoding.",
+		},
+		"base64": {
+			Input: "From: Test <test@example.com>\n" +
+				"Subject: [PATCH] Say hello\n" +
+				"Content-Type: text/plain; charset=utf-8\n" +
+				"Content-Transfer-Encoding: base64\n" +
+				"\n" +
+				"VGhlIGJvZHkKLS0tCmRpZmYgLS1naXQgYS9oZWxsby50eHQgYi9oZWxsby50eHQKaW5kZXggY2Uw\n" +
+				"MTM2Mi4uZGNiZTZlMyAxMDA2NDQKLS0tIGEvaGVsbG8udHh0CisrKyBiL2hlbGxvLnR4dApAQCAt\n" +
+				"MSArMSBAQAotaGVsbG8KK2hlbGxvLCBldmVyeW9uZQo=\n",
+			Author: "Test",
+			Title:  "Say hello",
+			Body:   "The body",
+		},
+		"attachment": {
+			Input: "From: Test <test@example.com>\n" +
+				"Subject: [PATCH] Say hello\n" +
+				"MIME-Version: 1.0\n" +
+				"Content-Type: multipart/mixed; boundary=\"XYZ\"\n" +
+				"\n" +
+				"--XYZ\n" +
+				"Content-Type: text/plain; charset=utf-8\n" +
+				"\n" +
+				"See the attached patch.\n" +
+				"--XYZ\n" +
+				"Content-Type: text/x-patch; name=\"hello.diff\"\n" +
+				"Content-Disposition: attachment; filename=\"hello.diff\"\n" +
+				"Content-Transfer-Encoding: base64\n" +
+				"\n" +
+				"ZGlmZiAtLWdpdCBhL2hlbGxvLnR4dCBiL2hlbGxvLnR4dAppbmRleCBjZTAxMzYyLi5kY2JlNmUz\n" +
+				"IDEwMDY0NAotLS0gYS9oZWxsby50eHQKKysrIGIvaGVsbG8udHh0CkBAIC0xICsxIEBACi1oZWxs\n" +
+				"bworaGVsbG8sIGV2ZXJ5b25lCg==\n" +
+				"--XYZ--\n",
+			Author: "Test",
+			Title:  "Say hello",
+			Body:   "See the attached patch.",
+		},
+		"attachedPatchEmails": {
+			Input: "From: Sender <sender@example.com>\n" +
+				"Subject: Two patches\n" +
+				"Content-Type: multipart/mixed; boundary=\"XYZ\"\n" +
+				"\n" +
+				"--XYZ\n" +
+				"Content-Type: text/plain\n" +
+				"\n" +
+				"Please apply these.\n" +
+				"--XYZ\n" +
+				"Content-Type: text/x-patch\n" +
+				"Content-Disposition: attachment; filename=\"0001-hello.patch\"\n" +
+				"\n" +
+				"From 5255ca3071e33871ad7c23de1a3962f19b215f74 Mon Sep 17 00:00:00 2001\n" +
+				"From: Author <author@example.com>\n" +
+				"Subject: [PATCH 1/2] Say hello\n" +
+				"\n" +
+				"---\n" + testPatchDiff +
+				"--XYZ\n" +
+				"Content-Type: text/x-patch\n" +
+				"Content-Disposition: attachment; filename=\"0002-hello.patch\"\n" +
+				"\n" +
+				"From 5a900b1a1f8b3e4244127bff85a5fd2d82ae2ced Mon Sep 17 00:00:00 2001\n" +
+				"From: Author <author@example.com>\n" +
+				"Subject: [PATCH 2/2] Say hello again\n" +
+				"\n" +
+				"---\n" + testPatchDiff +
+				"--XYZ--\n",
+			Count:  2,
+			Author: "Author",
+			Title:  "Say hello",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			messages, err := decodeMessage([]byte(test.Input))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			count := max(test.Count, 1)
+			if len(messages) != count {
+				t.Fatalf("incorrect number of messages: expected %d, got %d", count, len(messages))
+			}
+			if test.Unchanged && string(messages[0]) != test.Input {
+				t.Errorf("expected message to be unchanged, but got:\n%s", messages[0])
+			}
+
+			patch, err := parseMessage("test.mbox", messages[0])
+			if err != nil {
+				t.Fatalf("unexpected parse error: %v", err)
+			}
+			if len(patch.files) != 1 {
+				t.Fatalf("expected 1 file, got %d\nmessage:\n%s", len(patch.files), messages[0])
+			}
+			assertDecodedHeader(t, patch.header, test.Author, test.Title, test.Body)
+		})
+	}
+}
+
+func TestDecodeMessageLatin1Patch(t *testing.T) {
+	input := "From: Test <test@example.com>\n" +
+		"Subject: [PATCH] Update menu\n" +
+		"Content-Type: text/plain; charset=ISO-8859-1\n" +
+		"Content-Transfer-Encoding: quoted-printable\n" +
+		"\n" +
+		"Add the caf=E9 to the menu.\n" +
+		"---\n" +
+		"diff --git a/menu.txt b/menu.txt\n" +
+		"index 1111111..2222222 100644\n" +
+		"--- a/menu.txt\n" +
+		"+++ b/menu.txt\n" +
+		"@@ -1 +1,2 @@\n" +
+		" caf=E9\n" +
+		"+cr=E8me br=FBl=E9e\n"
+
+	messages, err := decodeMessage([]byte(input))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(messages) != 1 {
+		t.Fatalf("incorrect number of messages: expected 1, got %d", len(messages))
+	}
+
+	patch, err := parseMessage("test.mbox", messages[0])
+	if err != nil {
+		t.Fatalf("unexpected parse error: %v", err)
+	}
+	assertDecodedHeader(t, patch.header, "Test", "Update menu", "Add the café to the menu.")
+
+	if len(patch.files) != 1 || len(patch.files[0].TextFragments) != 1 {
+		t.Fatalf("expected 1 file with 1 fragment, got:\n%s", messages[0])
+	}
+
+	var lines []string
+	for _, l := range patch.files[0].TextFragments[0].Lines {
+		lines = append(lines, l.Line)
+	}
+	expected := []string{"caf\xe9\n", "cr\xe8me br\xfbl\xe9e\n"}
+	if strings.Join(lines, "") != strings.Join(expected, "") {
+		t.Errorf("incorrect diff lines: expected %q, got %q", expected, lines)
+	}
+}
+
+func TestDiffStart(t *testing.T) {
+	tests := map[string]struct {
+		Input    string
+		Expected int
+	}{
+		"gitDiff":     {"Message\n---\ndiff --git a/f b/f\n", 12},
+		"unifiedDiff": {"Message\n--- a/f\n+++ b/f\n", 8},
+		"separator":   {"Message\n---\n file | 1 +\n", -1},
+		"noDiff":      {"Message\n", -1},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := diffStart([]byte(test.Input)); got != test.Expected {
+				t.Errorf("incorrect start: expected %d, got %d", test.Expected, got)
+			}
+		})
+	}
+}
+
+func assertDecodedHeader(t *testing.T, h *gitdiff.PatchHeader, author, title, body string) {
+	if author == "" && title == "" {
+		return
+	}
+	if h == nil {
+		t.Fatal("expected patch header, but got nil")
+	}
+	if h.Author == nil || h.Author.Name != author {
+		t.Errorf("incorrect author: expected %q, got %+v", author, h.Author)
+	}
+	if h.Title != title {
+		t.Errorf("incorrect title: expected %q, got %q", title, h.Title)
+	}
+	if h.Body != body {
+		t.Errorf("incorrect body: expected %q, got %q", body, h.Body)
+	}
+}
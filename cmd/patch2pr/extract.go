@@ -0,0 +1,243 @@
+package main
+
+import (
+	"slices"
+	"strings"
+)
+
+// diffBlock is a diff found in Markdown or plain text.
+type diffBlock struct {
+	// start and end are the first and last lines of the diff in the input,
+	// starting from 1
+	start, end int
+
+	// fenced is true if the diff was in a Markdown code block
+	fenced bool
+
+	// fixed is the number of lines with repaired whitespace
+	fixed int
+
+	content []byte
+}
+
+// diffFenceLangs are the info strings of Markdown code blocks that contain
+// diffs. Code blocks without an info string are used if they look like diffs.
+var diffFenceLangs = []string{"diff", "patch", "udiff"}
+
+// nbsp is a non-breaking space, which some tools use instead of the leading
+// space of context lines
+const nbsp = "\u00a0"
+
+// extractDiffs finds the diffs in Markdown or plain text, like an issue body
+// or a chat message. Diffs may be in fenced code blocks or in the text itself.
+// Code blocks for other languages are ignored.
+//
+// Text editors and chat tools often remove trailing whitespace, which turns
+// blank context lines into empty lines, or replace the leading space of
+// context lines with a non-breaking space. extractDiffs repairs these lines
+// in each hunk so that the diff can be parsed.
+func extractDiffs(content []byte) []diffBlock {
+	lines := strings.Split(string(content), "\n")
+	if len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	var blocks []diffBlock
+	for i := 0; i < len(lines); {
+		if fence, indent, lang, ok := parseFence(lines[i]); ok {
+			end := i + 1
+			for end < len(lines) && !isClosingFence(lines[end], fence) {
+				end++
+			}
+
+			body := make([]string, end-i-1)
+			for j, line := range lines[i+1 : end] {
+				body[j] = trimIndent(line, indent)
+			}
+			if lang == "" && looksLikeDiff(body) || slices.Contains(diffFenceLangs, lang) {
+				fixed := repairDiff(body)
+				blocks = append(blocks, newDiffBlock(body, i+2, end, true, fixed))
+			}
+
+			i = end + 1
+			continue
+		}
+
+		if isDiffStart(lines[i:]) {
+			n, fixed := diffLength(lines[i:])
+			blocks = append(blocks, newDiffBlock(lines[i:i+n], i+1, i+n, false, fixed))
+			i += n
+			continue
+		}
+		i++
+	}
+	return blocks
+}
+
+func newDiffBlock(lines []string, start, end int, fenced bool, fixed int) diffBlock {
+	return diffBlock{
+		start:   start,
+		end:     end,
+		fenced:  fenced,
+		fixed:   fixed,
+		content: []byte(strings.Join(lines, "\n") + "\n"),
+	}
+}
+
+// parseFence returns the fence characters, indentation, and language of the
+// line if it opens a Markdown fenced code block.
+func parseFence(line string) (fence string, indent int, lang string, ok bool) {
+	trimmed := strings.TrimLeft(line, " \t")
+	indent = len(line) - len(trimmed)
+
+	if trimmed == "" || (trimmed[0] != '`' && trimmed[0] != '~') {
+		return "", 0, "", false
+	}
+
+	n := 0
+	for n < len(trimmed) && trimmed[n] == trimmed[0] {
+		n++
+	}
+	if n < 3 {
+		return "", 0, "", false
+	}
+
+	fence, info := trimmed[:n], strings.TrimSpace(trimmed[n:])
+	if fence[0] == '`' && strings.Contains(info, "`") {
+		return "", 0, "", false
+	}
+	if fields := strings.Fields(info); len(fields) > 0 {
+		lang = strings.ToLower(fields[0])
+	}
+	return fence, indent, lang, true
+}
+
+func isClosingFence(line, fence string) bool {
+	trimmed := strings.TrimSpace(line)
+	return strings.HasPrefix(trimmed, fence) && strings.Trim(trimmed, fence[:1]) == ""
+}
+
+// trimIndent removes up to n leading spaces or tabs from line, like the
+// indentation of the fence is removed from a code block in Markdown.
+func trimIndent(line string, n int) string {
+	i := 0
+	for i < n && i < len(line) && (line[i] == ' ' || line[i] == '\t') {
+		i++
+	}
+	return line[i:]
+}
+
+func looksLikeDiff(lines []string) bool {
+	for i := range lines {
+		if isDiffStart(lines[i:]) {
+			return true
+		}
+	}
+	return false
+}
+
+// isDiffStart returns true if lines start with the header of a Git diff or a
+// traditional unified diff.
+func isDiffStart(lines []string) bool {
+	if strings.HasPrefix(lines[0], "diff --git ") {
+		return true
+	}
+	return len(lines) > 1 && strings.HasPrefix(lines[0], "--- ") && strings.HasPrefix(lines[1], "+++ ")
+}
+
+// diffHeaderPrefixes are the prefixes of lines that may appear in the file
+// headers of a diff.
+var diffHeaderPrefixes = []string{
+	"diff --git ",
+	"--- ",
+	"+++ ",
+	"index ",
+	"old mode ",
+	"new mode ",
+	"deleted file mode ",
+	"new file mode ",
+	"similarity index ",
+	"dissimilarity index ",
+	"rename from ",
+	"rename to ",
+	"copy from ",
+	"copy to ",
+	"Binary files ",
+}
+
+// diffLength returns the number of lines at the start of lines that are part
+// of a diff, repairing the lines of each hunk. It also returns the number of
+// lines that were repaired.
+func diffLength(lines []string) (n, fixed int) {
+	for n < len(lines) {
+		if h, ok := parseHunkHeader(lines[n]); ok {
+			size, f := repairHunk(lines[n+1:], h.oldLines, h.newLines)
+			n += 1 + size
+			fixed += f
+			continue
+		}
+		if !hasAnyPrefix(lines[n], diffHeaderPrefixes) {
+			break
+		}
+		n++
+	}
+	return n, fixed
+}
+
+// repairDiff repairs the lines of each hunk in lines, which may also contain
+// text that is not part of the diff. It returns the number of lines that were
+// repaired.
+func repairDiff(lines []string) (fixed int) {
+	for i := 0; i < len(lines); i++ {
+		if h, ok := parseHunkHeader(lines[i]); ok {
+			size, f := repairHunk(lines[i+1:], h.oldLines, h.newLines)
+			i += size
+			fixed += f
+		}
+	}
+	return fixed
+}
+
+// repairHunk repairs the body of a hunk with the given line counts in place.
+// It returns the number of lines in the body and the number of lines that
+// were repaired. If a line cannot be part of the hunk, the body ends before
+// that line.
+func repairHunk(body []string, oldLines, newLines int) (n, fixed int) {
+	for ; n < len(body) && (oldLines > 0 || newLines > 0); n++ {
+		line := body[n]
+		switch {
+		case line == "" || line == "\r":
+			body[n] = " " + line
+			fixed++
+		case strings.HasPrefix(line, nbsp):
+			body[n] = " " + strings.TrimPrefix(line, nbsp)
+			fixed++
+		}
+
+		switch body[n][0] {
+		case ' ':
+			oldLines--
+			newLines--
+		case '-':
+			oldLines--
+		case '+':
+			newLines--
+		case '\\':
+		default:
+			return n, fixed
+		}
+	}
+	if n < len(body) && strings.HasPrefix(body[n], "\\ ") {
+		n++
+	}
+	return n, fixed
+}
+
+func hasAnyPrefix(s string, prefixes []string) bool {
+	for _, p := range prefixes {
+		if strings.HasPrefix(s, p) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/bluekeyes/go-gitdiff/gitdiff"
+)
+
+func TestExtractDiffs(t *testing.T) {
+	input := strings.Join([]string{
+		"The greeting is too short. This fixes it:",
+		"",
+		"```diff",
+		"diff --git a/hello.txt b/hello.txt",
+		"--- a/hello.txt",
+		"+++ b/hello.txt",
+		"@@ -1,3 +1,3 @@",
+		"-hello",
+		"+hello, world",
+		"",
+		" goodbye",
+		"```",
+		"",
+		"This is how the function is called:",
+		"",
+		"```go",
+		"--- not a diff",
+		"+++ not a diff",
+		"```",
+		"",
+		"And the docs need an update too:",
+		"",
+		"--- docs/README.md",
+		"+++ docs/README.md",
+		"@@ -1,2 +1,4 @@",
+		" # Hello",
+		"+",
+		"+Says hello.",
+		"",
+		"Thanks!",
+		"",
+		"  ~~~",
+		"  --- a.txt",
+		"  +++ a.txt",
+		"  @@ -1 +1 @@",
+		"  -a",
+		"  +b",
+		"  ~~~",
+	}, "\n") + "\n"
+
+	blocks := extractDiffs([]byte(input))
+
+	expected := []struct {
+		Start, End int
+		Fenced     bool
+		Fixed      int
+		Files      []string
+	}{
+		{Start: 4, End: 11, Fenced: true, Fixed: 2, Files: []string{"hello.txt"}},
+		{Start: 23, End: 29, Fenced: false, Fixed: 1, Files: []string{"docs/README.md"}},
+		{Start: 33, End: 37, Fenced: true, Fixed: 0, Files: []string{"a.txt"}},
+	}
+
+	if len(blocks) != len(expected) {
+		t.Fatalf("incorrect number of blocks: expected %d, actual %d", len(expected), len(blocks))
+	}
+
+	for i, exp := range expected {
+		b := blocks[i]
+		if b.start != exp.Start || b.end != exp.End {
+			t.Errorf("block %d: incorrect lines: expected %d-%d, actual %d-%d", i, exp.Start, exp.End, b.start, b.end)
+		}
+		if b.fenced != exp.Fenced {
+			t.Errorf("block %d: incorrect fenced: expected %t, actual %t", i, exp.Fenced, b.fenced)
+		}
+		if b.fixed != exp.Fixed {
+			t.Errorf("block %d: incorrect fixed lines: expected %d, actual %d", i, exp.Fixed, b.fixed)
+		}
+
+		files, _, err := gitdiff.Parse(bytes.NewReader(b.content))
+		if err != nil {
+			t.Errorf("block %d: unexpected parse error: %v\n%s", i, err, b.content)
+			continue
+		}
+
+		var names []string
+		for _, f := range files {
+			names = append(names, f.NewName)
+		}
+		if strings.Join(names, ",") != strings.Join(exp.Files, ",") {
+			t.Errorf("block %d: incorrect files: expected %q, actual %q", i, exp.Files, names)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"bufio"
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
@@ -10,11 +11,13 @@ import (
 	"io"
 	"net/http"
 	"os"
+	"path/filepath"
 	"strings"
 	"time"
 
 	"github.com/bluekeyes/go-gitdiff/gitdiff"
 	"github.com/google/go-github/v89/github"
+	"github.com/shurcooL/githubv4"
 
 	"github.com/bluekeyes/patch2pr"
 	"github.com/bluekeyes/patch2pr/internal"
@@ -41,21 +44,41 @@ from a fork.
 }
 
 type Options struct {
-	BaseBranch     string
-	Draft          bool
-	Force          bool
-	Fork           bool
-	ForkRepository *patch2pr.Repository
-	HeadBranch     string
-	OutputJSON     bool
-	Message        string
-	NoPullRequest  bool
-	PatchBase      string
-	PullTitle      string
-	Repository     *patch2pr.Repository
-	GitHubToken    string
-	GitHubURL      string
-	PullBody       string
+	Assignees         []string
+	AutoMerge         string
+	BaseBranch        string
+	Draft             bool
+	DraftSet          bool
+	Extract           bool
+	Force             bool
+	Fork              bool
+	ForkRepository    *patch2pr.Repository
+	Fuzz              int
+	HeadBranch        string
+	IgnoreWhitespace  bool
+	Labels            []string
+	MaxOffset         int
+	MBoxFormat        string
+	OutputJSON        bool
+	Message           string
+	Milestone         string
+	NoPullRequest     bool
+	PartialSeries     bool
+	PatchBase         string
+	Series            string
+	PullTitle         string
+	RebaseRetries     int
+	Recount           bool
+	Repository        *patch2pr.Repository
+	Reviewers         []string
+	Stack             bool
+	UpdatePullRequest int
+	Wait              bool
+	WaitTimeout       time.Duration
+	Whitespace        string
+	GitHubToken       string
+	GitHubURL         string
+	PullBody          string
 }
 
 func main() {
@@ -65,21 +88,40 @@ func main() {
 	fs.SetOutput(io.Discard)
 	fs.Usage = func() {}
 
+	fs.Var(StringListValue{&opts.Assignees}, "assignee", "assignee")
+	fs.StringVar(&opts.AutoMerge, "auto-merge", "", "auto-merge")
 	fs.StringVar(&opts.BaseBranch, "base-branch", "", "base-branch")
 	fs.BoolVar(&opts.Draft, "draft", false, "draft")
+	fs.BoolVar(&opts.Extract, "extract", false, "extract")
 	fs.BoolVar(&opts.Force, "force", false, "force")
 	fs.BoolVar(&opts.Fork, "fork", false, "fork")
 	fs.Var(ForkValue{RepositoryValue{&opts.ForkRepository}, &opts.Fork}, "fork-repository", "fork-repository")
+	fs.IntVar(&opts.Fuzz, "fuzz", 0, "fuzz")
 	fs.StringVar(&opts.HeadBranch, "head-branch", "patch2pr", "head-branch")
+	fs.BoolVar(&opts.IgnoreWhitespace, "ignore-whitespace", false, "ignore-whitespace")
 	fs.BoolVar(&opts.OutputJSON, "json", false, "json")
+	fs.Var(StringListValue{&opts.Labels}, "label", "label")
+	fs.IntVar(&opts.MaxOffset, "max-offset", 0, "max-offset")
+	fs.StringVar(&opts.MBoxFormat, "mbox-format", "auto", "mbox-format")
 	fs.StringVar(&opts.Message, "message", "", "message")
+	fs.StringVar(&opts.Milestone, "milestone", "", "milestone")
 	fs.BoolVar(&opts.NoPullRequest, "no-pull-request", false, "no-pull-request")
+	fs.BoolVar(&opts.PartialSeries, "partial-series", false, "partial-series")
 	fs.StringVar(&opts.PatchBase, "patch-base", "", "patch-base")
 	fs.StringVar(&opts.PullBody, "pull-body", "", "pull-body")
 	fs.StringVar(&opts.PullTitle, "pull-title", "", "pull-title")
+	fs.IntVar(&opts.RebaseRetries, "rebase-retries", 0, "rebase-retries")
+	fs.BoolVar(&opts.Recount, "recount", false, "recount")
 	fs.Var(RepositoryValue{&opts.Repository}, "repository", "repository")
+	fs.Var(StringListValue{&opts.Reviewers}, "reviewer", "reviewer")
+	fs.StringVar(&opts.Series, "series", "", "series")
+	fs.BoolVar(&opts.Stack, "stack", false, "stack")
 	fs.StringVar(&opts.GitHubToken, "token", "", "token")
+	fs.IntVar(&opts.UpdatePullRequest, "update-pull-request", 0, "update-pull-request")
 	fs.StringVar(&opts.GitHubURL, "url", "https://api.github.com/", "url")
+	fs.BoolVar(&opts.Wait, "wait", false, "wait")
+	fs.DurationVar(&opts.WaitTimeout, "wait-timeout", 30*time.Minute, "wait-timeout")
+	fs.StringVar(&opts.Whitespace, "whitespace", "nowarn", "whitespace")
 
 	var printVersion bool
 	fs.BoolVar(&printVersion, "v", false, "version")
@@ -93,6 +135,12 @@ func main() {
 		die(2, err)
 	}
 
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == "draft" {
+			opts.DraftSet = true
+		}
+	})
+
 	if printVersion {
 		fmt.Fprintln(os.Stdout, version)
 		os.Exit(0)
@@ -101,6 +149,51 @@ func main() {
 	if opts.Repository == nil {
 		die(2, errors.New("the -repository flag is required"))
 	}
+	if opts.AutoMerge != "" {
+		if _, err := parseMergeMethod(opts.AutoMerge); err != nil {
+			die(2, err)
+		}
+	}
+	if _, err := parseMBoxFormat(opts.MBoxFormat); err != nil {
+		die(2, err)
+	}
+	if _, err := pullRequestMetadata(&opts); err != nil {
+		die(2, err)
+	}
+	if _, err := parseWhitespaceMode(opts.Whitespace); err != nil {
+		die(2, err)
+	}
+	if opts.Series != "" && fs.NArg() > 0 {
+		die(2, errors.New("the -series flag cannot be used with patch file arguments"))
+	}
+	if opts.Fuzz < 0 || opts.MaxOffset < 0 {
+		die(2, errors.New("the -fuzz and -max-offset flags must not be negative"))
+	}
+	if opts.Series != "" && opts.Extract {
+		die(2, errors.New("the -series flag cannot be used with -extract"))
+	}
+	if opts.Stack {
+		switch {
+		case opts.Fork:
+			die(2, errors.New("the -stack flag cannot be used with -fork or -fork-repository"))
+		case opts.NoPullRequest:
+			die(2, errors.New("the -stack flag cannot be used with -no-pull-request"))
+		case opts.UpdatePullRequest > 0:
+			die(2, errors.New("the -stack flag cannot be used with -update-pull-request"))
+		}
+	}
+	if opts.UpdatePullRequest > 0 {
+		switch {
+		case opts.Fork:
+			die(2, errors.New("the -update-pull-request flag cannot be used with -fork or -fork-repository"))
+		case opts.Force:
+			die(2, errors.New("the -update-pull-request flag cannot be used with -force"))
+		case opts.PatchBase != "":
+			die(2, errors.New("the -update-pull-request flag cannot be used with -patch-base"))
+		case opts.NoPullRequest:
+			die(2, errors.New("the -update-pull-request flag cannot be used with -no-pull-request"))
+		}
+	}
 	if opts.GitHubToken == "" {
 		if t, ok := os.LookupEnv("GITHUB_TOKEN"); ok {
 			opts.GitHubToken = t
@@ -119,6 +212,7 @@ func main() {
 	if err != nil {
 		die(1, fmt.Errorf("creating GitHub client failed: %w", err))
 	}
+	v4client := githubv4.NewEnterpriseClient(graphQLURL(opts.GitHubURL), tc)
 
 	var patchFiles []string
 	if fs.NArg() == 0 {
@@ -127,7 +221,7 @@ func main() {
 		patchFiles = fs.Args()
 	}
 
-	res, err := execute(ctx, client, patchFiles, &opts)
+	res, err := execute(ctx, client, v4client, patchFiles, &opts)
 	if err != nil {
 		die(1, err)
 	}
@@ -144,26 +238,119 @@ func main() {
 	default:
 		fmt.Println(res.Commit)
 	}
+
+	if len(res.Errors) > 0 {
+		for _, msg := range res.Errors {
+			fmt.Fprintln(os.Stderr, "error:", msg)
+		}
+		os.Exit(1)
+	}
 }
 
 type Patch struct {
 	path   string
 	files  []*gitdiff.File
 	header *gitdiff.PatchHeader
+
+	// extracted are the diffs in Markdown or plain text that contained the
+	// files, if the patch was extracted
+	extracted []diffBlock
 }
 
 type Result struct {
-	Commit      string             `json:"commit"`
-	Tree        string             `json:"tree"`
-	PullRequest *PullRequestResult `json:"pull_request,omitempty"`
+	Commit      string              `json:"commit"`
+	Tree        string              `json:"tree"`
+	Commits     []CommitResult      `json:"commits,omitempty"`
+	Rebases     int                 `json:"rebases,omitempty"`
+	PullRequest *PullRequestResult  `json:"pull_request,omitempty"`
+	Checks      *ChecksResult       `json:"checks,omitempty"`
+	Stack       []StackEntryResult  `json:"stack,omitempty"`
+	Closed      []PullRequestResult `json:"closed,omitempty"`
+	Revision    *RevisionResult     `json:"revision,omitempty"`
+	Extracted   []ExtractedResult   `json:"extracted,omitempty"`
+	Fuzzy       []FuzzyResult       `json:"fuzzy,omitempty"`
+	Whitespace  []WhitespaceResult  `json:"whitespace,omitempty"`
+
+	// Errors contains failures that happened after the pull request was
+	// created or updated. These do not stop execution, but the command still
+	// exits with a non-zero status.
+	Errors []string `json:"errors,omitempty"`
+}
+
+// CommitResult describes each commit created from a patch. Source is the file
+// that contained the patch, or "-" for standard input.
+type CommitResult struct {
+	SHA    string `json:"sha"`
+	Source string `json:"source"`
+}
+
+// ExtractedResult describes a diff found in Markdown or plain text input and
+// used to create a commit. StartLine and EndLine are the lines of the diff in
+// Source. Fixed is the number of lines with whitespace damage that were
+// repaired.
+type ExtractedResult struct {
+	Source    string `json:"source"`
+	StartLine int    `json:"start_line"`
+	EndLine   int    `json:"end_line"`
+	Fenced    bool   `json:"fenced"`
+	Fixed     int    `json:"fixed,omitempty"`
+}
+
+// FuzzyResult describes a hunk that applied at a different line or with less
+// context than in the patch. Line is the first line of the hunk in the patch,
+// Offset is the number of lines the hunk moved, and Fuzz is the number of
+// context lines ignored at the start and end of the hunk.
+type FuzzyResult struct {
+	Commit string `json:"commit"`
+	Source string `json:"source"`
+	File   string `json:"file"`
+	Hunk   int    `json:"hunk"`
+	Line   int64  `json:"line"`
+	Offset int64  `json:"offset"`
+	Fuzz   int    `json:"fuzz"`
+}
+
+// WhitespaceResult describes a file with whitespace errors in added lines or
+// with context lines that matched only after ignoring whitespace. Fixed is true
+// if the trailing whitespace and blank lines at the end of the file were
+// removed.
+type WhitespaceResult struct {
+	Commit             string `json:"commit"`
+	Source             string `json:"source"`
+	File               string `json:"file"`
+	TrailingWhitespace int    `json:"trailing_whitespace,omitempty"`
+	BlankAtEOF         int    `json:"blank_at_eof,omitempty"`
+	IgnoredContext     int    `json:"ignored_context,omitempty"`
+	Fixed              bool   `json:"fixed,omitempty"`
 }
 
 type PullRequestResult struct {
-	Number int    `json:"number"`
-	URL    string `json:"url"`
+	Number    int    `json:"number"`
+	URL       string `json:"url"`
+	Updated   bool   `json:"updated,omitempty"`
+	AutoMerge string `json:"auto_merge,omitempty"`
 }
 
-func parse(patchFile string) ([]Patch, error) {
+type ChecksResult struct {
+	State  string        `json:"state"`
+	Checks []CheckResult `json:"checks"`
+}
+
+type CheckResult struct {
+	Name   string `json:"name"`
+	State  string `json:"state"`
+	Detail string `json:"detail"`
+	URL    string `json:"url,omitempty"`
+}
+
+// parseOptions control how patch files are parsed.
+type parseOptions struct {
+	format  mboxFormat
+	extract bool
+	recount bool
+}
+
+func parse(patchFile string, popts parseOptions) ([]Patch, error) {
 	var r io.ReadCloser
 	if patchFile == "-" {
 		r = os.Stdin
@@ -176,31 +363,178 @@ func parse(patchFile string) ([]Patch, error) {
 	}
 	defer closeQuitely(r)
 
-	mbr := mboxMessageReader{r: r}
+	dr, err := decompress(r)
+	if err != nil {
+		return nil, fmt.Errorf("reading patch file failed: %w", err)
+	}
+
+	br := bufio.NewReader(dr)
+	if !isTar(br) {
+		return parseInput(patchFile, br, popts)
+	}
+
+	entries, err := readTar(br)
+	if err != nil {
+		return nil, err
+	}
+
+	var patches []Patch
+	for _, e := range entries {
+		entryPatches, err := parseInput(fmt.Sprintf("%s:%s", patchFile, e.name), bytes.NewReader(e.content), popts)
+		if err != nil {
+			return nil, err
+		}
+		patches = append(patches, entryPatches...)
+	}
+	return patches, nil
+}
+
+func parseInput(patchFile string, r io.Reader, popts parseOptions) ([]Patch, error) {
+	if popts.extract {
+		return parseExtracted(patchFile, r, popts)
+	}
+	return parseMessages(patchFile, r, popts)
+}
+
+// parseMessages parses the patches in each message of an mbox file. If the
+// input is not an mbox file, it parses the patches in the whole input.
+func parseMessages(patchFile string, r io.Reader, popts parseOptions) ([]Patch, error) {
+	mbr := newMBoxMessageReader(r, popts.format)
 
 	var patches []Patch
 	for mbr.Next() {
-		files, preamble, err := gitdiff.Parse(&mbr)
+		raw, err := io.ReadAll(mbr)
 		if err != nil {
-			return nil, fmt.Errorf("parsing patch failed: %w", err)
+			return nil, fmt.Errorf("reading patch file failed: %w", err)
 		}
 
-		var header *gitdiff.PatchHeader
-		if len(preamble) > 0 {
-			header, err = gitdiff.ParsePatchHeader(preamble)
+		messages, err := decodeMessage(raw)
+		if err != nil {
+			return nil, fmt.Errorf("decoding patch email failed: %w", err)
+		}
+
+		for _, msg := range messages {
+			if popts.recount {
+				msg = recount(patchFile, msg)
+			}
+			patch, err := parseMessage(patchFile, msg)
 			if err != nil {
-				fmt.Fprintf(os.Stderr, "warning: invalid patch header: %v", err)
+				return nil, err
 			}
+			patches = append(patches, patch)
 		}
+	}
+	if err := mbr.Err(); err != nil {
+		return nil, fmt.Errorf("reading patch file failed: %w", err)
+	}
+	return patches, nil
+}
 
-		patches = append(patches, Patch{patchFile, files, header})
+// parseExtracted parses the diffs in Markdown or plain text as a single patch.
+// If a diff starts with a valid patch header, like the output of 'git
+// format-patch', the first header is used for the patch.
+func parseExtracted(patchFile string, r io.Reader, popts parseOptions) ([]Patch, error) {
+	content, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("reading patch file failed: %w", err)
+	}
+
+	patch := Patch{path: patchFile}
+	blocks := extractDiffs(content)
+	for _, b := range blocks {
+		if popts.recount {
+			b.content = recount(fmt.Sprintf("%s:%d-%d", patchFile, b.start, b.end), b.content)
+		}
+
+		files, preamble, err := gitdiff.Parse(bytes.NewReader(b.content))
+		if err != nil {
+			return nil, fmt.Errorf("parsing patch in lines %d-%d of %s failed: %w", b.start, b.end, patchFile, err)
+		}
+		if len(files) == 0 {
+			fmt.Fprintf(os.Stderr, "warning: ignoring code block in lines %d-%d of %s: no diff found\n", b.start, b.end, patchFile)
+			continue
+		}
+
+		// Only say which diff was used when it is not obvious
+		if len(blocks) > 1 || b.fixed > 0 {
+			fmt.Fprintf(os.Stderr, "using diff in lines %d-%d of %s\n", b.start, b.end, patchFile)
+		}
+		if b.fixed > 0 {
+			fmt.Fprintf(os.Stderr, "warning: repaired whitespace in %d lines of the diff in lines %d-%d of %s\n", b.fixed, b.start, b.end, patchFile)
+		}
+
+		if patch.header == nil && preamble != "" {
+			if h, err := gitdiff.ParsePatchHeader(preamble); err == nil && h.Title != "" {
+				stripTitlePrefix(h)
+				patch.header = h
+			}
+		}
+		patch.files = append(patch.files, files...)
+		patch.extracted = append(patch.extracted, b)
+	}
+
+	if len(patch.files) == 0 {
+		return nil, fmt.Errorf("no diffs found in %s", patchFile)
+	}
+	return []Patch{patch}, nil
+}
+
+// parseQuiltSeries parses the patches listed in a quilt series file. Patches
+// without a header are titled using their file names.
+func parseQuiltSeries(seriesFile string, popts parseOptions) ([]Patch, error) {
+	dir := filepath.Dir(seriesFile)
+
+	fsys := os.DirFS(dir)
+	if popts.recount {
+		fsys = recountFS{fsys}
+	}
+
+	series, err := patch2pr.ReadSeries(fsys, filepath.Base(seriesFile))
+	if err != nil {
+		return nil, err
+	}
+
+	patches := make([]Patch, len(series))
+	for i, sp := range series {
+		stripTitlePrefix(sp.Header)
+		patches[i] = Patch{path: filepath.Join(dir, sp.Name), files: sp.Files, header: sp.Header}
 	}
 	return patches, nil
 }
 
-func execute(ctx context.Context, client *github.Client, patchFiles []string, opts *Options) (*Result, error) {
+func parseMessage(patchFile string, msg []byte) (Patch, error) {
+	files, preamble, err := gitdiff.Parse(bytes.NewReader(msg))
+	if err != nil {
+		return Patch{}, fmt.Errorf("parsing patch failed: %w", err)
+	}
+
+	var header *gitdiff.PatchHeader
+	if len(preamble) > 0 {
+		header, err = gitdiff.ParsePatchHeader(preamble)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "warning: invalid patch header: %v", err)
+		}
+		stripTitlePrefix(header)
+	}
+
+	return Patch{path: patchFile, files: files, header: header}, nil
+}
+
+func execute(ctx context.Context, client *github.Client, v4client *githubv4.Client, patchFiles []string, opts *Options) (*Result, error) {
 	targetRepo := *opts.Repository
 	patchBase, baseBranch, headBranch := opts.PatchBase, opts.BaseBranch, opts.HeadBranch
+	patchBaseRepo := targetRepo
+
+	var updatePR *github.PullRequest
+	if opts.UpdatePullRequest > 0 {
+		var err error
+		if updatePR, err = getPullRequestForUpdate(ctx, client, targetRepo, opts.UpdatePullRequest); err != nil {
+			return nil, err
+		}
+		head := updatePR.GetHead()
+		patchBase, baseBranch, headBranch = head.GetSHA(), updatePR.GetBase().GetRef(), head.GetRef()
+		patchBaseRepo = patch2pr.Repository{Owner: head.GetRepo().GetOwner().GetLogin(), Name: head.GetRepo().GetName()}
+	}
 
 	if patchBase == "" || (baseBranch == "" && !opts.NoPullRequest) {
 		r, _, err := client.Repositories.Get(ctx, targetRepo.Owner, targetRepo.Name)
@@ -223,103 +557,471 @@ func execute(ctx context.Context, client *github.Client, patchFiles []string, op
 		patchBase = ref.GetObject().GetSHA()
 	}
 
-	commit, _, err := client.Git.GetCommit(ctx, targetRepo.Owner, targetRepo.Name, patchBase)
+	commit, _, err := client.Git.GetCommit(ctx, patchBaseRepo.Owner, patchBaseRepo.Name, patchBase)
 	if err != nil {
 		return nil, fmt.Errorf("get commit for %s failed: %w", patchBase, err)
 	}
 
+	format, err := parseMBoxFormat(opts.MBoxFormat)
+	if err != nil {
+		return nil, err
+	}
+	popts := parseOptions{format: format, extract: opts.Extract, recount: opts.Recount}
+
+	whitespace, err := parseWhitespaceMode(opts.Whitespace)
+	if err != nil {
+		return nil, err
+	}
+
 	var allPatches []Patch
-	for _, patchFile := range patchFiles {
-		patches, err := parse(patchFile)
+	var cover *gitdiff.PatchHeader
+	if opts.Series != "" {
+		// The series file sets the order, so ignore any numbers in subjects
+		if allPatches, err = parseQuiltSeries(opts.Series, popts); err != nil {
+			return nil, err
+		}
+	} else {
+		patchFiles, err = expandPatchFiles(patchFiles)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, patchFile := range patchFiles {
+			patches, err := parse(patchFile, popts)
+			if err != nil {
+				return nil, err
+			}
+			allPatches = append(allPatches, patches...)
+		}
+
+		if cover, allPatches, err = splitCoverLetter(allPatches); err != nil {
+			return nil, err
+		}
+		if allPatches, err = orderSeries(allPatches, opts.PartialSeries); err != nil {
+			return nil, err
+		}
+	}
+	if len(allPatches) == 0 {
+		return nil, errors.New("no patches found")
+	}
+
+	sourceRepo := patchBaseRepo
+	if updatePR == nil {
+		if sourceRepo, err = prepareSourceRepo(ctx, client, opts); err != nil {
+			return nil, err
+		}
+	}
+
+	prs := patch2pr.NewGraphQLPullRequests(v4client, targetRepo)
+
+	if opts.Stack {
+		applier := patch2pr.NewApplier(client, sourceRepo, commit)
+		applier.SetFuzz(opts.MaxOffset, opts.Fuzz)
+		applier.SetWhitespace(whitespace, opts.IgnoreWhitespace)
+		res, err := executeStack(ctx, client, prs, sourceRepo, applier, allPatches, baseBranch, headBranch, opts)
 		if err != nil {
 			return nil, err
 		}
-		allPatches = append(allPatches, patches...)
+		res.Extracted = extractedResults(allPatches)
+		return res, nil
 	}
 
-	sourceRepo, err := prepareSourceRepo(ctx, client, opts)
+	ref := patch2pr.NewReference(client, sourceRepo, fmt.Sprintf("refs/heads/%s", headBranch))
+	ref.SetV4Client(v4client)
+
+	// Check the head branch before applying patches to avoid doing work that
+	// cannot be pushed. Existing pull requests are found later if needed.
+	protected, err := ref.Protected(ctx)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("get head branch status failed: %w", err)
+	}
+	if protected {
+		return nil, fmt.Errorf("head branch %q is protected and cannot be updated", headBranch)
 	}
 
 	applier := patch2pr.NewApplier(client, sourceRepo, commit)
+	applier.SetFuzz(opts.MaxOffset, opts.Fuzz)
+	applier.SetWhitespace(whitespace, opts.IgnoreWhitespace)
 
-	var newCommit *github.Commit
-	for _, patch := range allPatches {
-		for _, file := range patch.files {
-			if _, err := applier.Apply(ctx, file); err != nil {
-				var namePart string
-				if !errors.Is(err, &patch2pr.Conflict{}) {
-					name := file.NewName
-					if name == "" {
-						name = file.OldName
-					}
-					namePart = name + ": "
-				}
-				return nil, fmt.Errorf("apply failed: %s%w", namePart, err)
+	newCommits, warnings, err := applyPatches(ctx, applier, allPatches, opts)
+	if err != nil {
+		return nil, err
+	}
+	newCommit := newCommits[len(newCommits)-1]
+
+	// A new revision of a patch series replaces the commits of the previous
+	// revision, so force update the branch and compare the two revisions
+	var prevRevision *revision
+	version := seriesVersion(allPatches)
+	if updatePR == nil && !opts.NoPullRequest && version > 1 {
+		title, _ := pullRequestText(newCommit, cover, opts)
+		if prevRevision, err = findPreviousRevision(ctx, client, prs, sourceRepo, targetRepo, baseBranch, headBranch, title); err != nil {
+			return nil, fmt.Errorf("find previous revision failed: %w", err)
+		}
+	}
+	force := opts.Force || prevRevision != nil
+
+	update := &headUpdate{
+		ref:     ref,
+		branch:  headBranch,
+		force:   force,
+		retries: opts.RebaseRetries,
+		isAncestor: func(ctx context.Context, tip, sha string) (bool, error) {
+			cmp, _, err := client.Repositories.CompareCommits(ctx, sourceRepo.Owner, sourceRepo.Name, tip, sha, &github.ListOptions{PerPage: 1})
+			if err != nil {
+				return false, fmt.Errorf("compare head branch %q failed: %w", headBranch, err)
 			}
+			s := cmp.GetStatus()
+			return s == "ahead" || s == "identical", nil
+		},
+		rebase: func(ctx context.Context, tip string) ([]*github.Commit, error) {
+			tipCommit, _, err := client.Git.GetCommit(ctx, sourceRepo.Owner, sourceRepo.Name, tip)
+			if err != nil {
+				return nil, fmt.Errorf("get commit for head branch %q failed: %w", headBranch, err)
+			}
+
+			applier.Reset(tipCommit)
+
+			var commits []*github.Commit
+			if commits, warnings, err = applyPatches(ctx, applier, allPatches, opts); err != nil {
+				return nil, fmt.Errorf("rebase on %s failed: %w", tip, err)
+			}
+			return commits, nil
+		},
+	}
+
+	// When updating a pull request, only update the branch if it still points
+	// to the commit used as the base
+	var expectedHead string
+	if updatePR != nil {
+		expectedHead = patchBase
+	}
+
+	newCommits, rebases, err := update.run(ctx, newCommits, expectedHead)
+	if err != nil {
+		return nil, err
+	}
+	newCommit = newCommits[len(newCommits)-1]
+
+	var pr *patch2pr.PullRequest
+	var prCreated bool
+	switch {
+	case updatePR != nil:
+		pr = &patch2pr.PullRequest{
+			ID:          updatePR.GetNodeID(),
+			Number:      updatePR.GetNumber(),
+			URL:         updatePR.GetHTMLURL(),
+			Title:       updatePR.GetTitle(),
+			Body:        updatePR.GetBody(),
+			IsDraft:     updatePR.GetDraft(),
+			BaseRefName: baseBranch,
+			HeadRefName: headBranch,
+			HeadRefOID:  newCommit.GetSHA(),
+		}
+
+	case !opts.NoPullRequest:
+		title, body := pullRequestText(newCommit, cover, opts)
+		prSpec := pullRequestSpec(title, body, baseBranch, opts)
+
+		if pr, prCreated, err = prs.CreateOrUpdate(ctx, sourceRepo, headBranch, prSpec); err != nil {
+			return nil, err
+		}
+	}
+
+	res := &Result{
+		Commit:     newCommit.GetSHA(),
+		Tree:       newCommit.GetTree().GetSHA(),
+		Commits:    commitResults(newCommits, allPatches),
+		Rebases:    rebases,
+		Extracted:  extractedResults(allPatches),
+		Fuzzy:      warnings.fuzzy,
+		Whitespace: warnings.whitespace,
+	}
+	if pr != nil {
+		res.PullRequest = &PullRequestResult{
+			Number:  pr.Number,
+			URL:     pr.URL,
+			Updated: !prCreated,
+		}
+
+		res.Errors = append(res.Errors, finishPullRequest(ctx, client, prs, targetRepo, pr, res.PullRequest, opts)...)
+	}
+	if prevRevision != nil {
+		res.Revision = &RevisionResult{
+			Version:         version,
+			PreviousCommits: len(prevRevision.commits),
+		}
+		if err := commentRangeDiff(ctx, client, sourceRepo, targetRepo, pr, prevRevision, newCommits, res.Revision); err != nil {
+			res.Errors = append(res.Errors, err.Error())
+		}
+	}
+	if opts.Wait {
+		// Checks for pull requests from forks run in the target repository
+		checkRepo := sourceRepo
+		if pr != nil {
+			checkRepo = targetRepo
 		}
 
-		newCommit, err = applier.Commit(ctx, nil, fillHeader(patch.header, patch.path, opts.Message))
+		checks, err := waitForChecks(ctx, client, checkRepo, newCommit.GetSHA(), opts.WaitTimeout)
+		res.Checks = checks
 		if err != nil {
-			return nil, fmt.Errorf("commit failed: %w", err)
+			res.Errors = append(res.Errors, err.Error())
 		}
 	}
 
-	ref := patch2pr.NewReference(client, sourceRepo, fmt.Sprintf("refs/heads/%s", headBranch))
-	if err := ref.Set(ctx, newCommit.GetSHA(), opts.Force); err != nil {
-		return nil, fmt.Errorf("set ref failed: %w", err)
+	return res, nil
+}
+
+func commitResults(commits []*github.Commit, patches []Patch) []CommitResult {
+	res := make([]CommitResult, len(commits))
+	for i, c := range commits {
+		res[i] = CommitResult{SHA: c.GetSHA(), Source: patches[i].path}
+	}
+	return res
+}
+
+func extractedResults(patches []Patch) []ExtractedResult {
+	var res []ExtractedResult
+	for _, p := range patches {
+		for _, b := range p.extracted {
+			res = append(res, ExtractedResult{
+				Source:    p.path,
+				StartLine: b.start,
+				EndLine:   b.end,
+				Fenced:    b.fenced,
+				Fixed:     b.fixed,
+			})
+		}
 	}
+	return res
+}
 
-	var pr *github.PullRequest
-	if !opts.NoPullRequest {
-		var title, body string
+// pullRequestText returns the title and body for a new pull request. The
+// cover letter, if not nil, takes precedence over the commit message.
+func pullRequestText(c *github.Commit, cover *gitdiff.PatchHeader, opts *Options) (title string, body string) {
+	if cover != nil {
+		title, body = coverLetterText(cover)
+	}
+	if title == "" {
 		if opts.Message != "" {
 			title, body = splitMessage(opts.Message)
 		} else {
-			title, body = splitMessage(newCommit.GetMessage())
+			title, body = splitMessage(c.GetMessage())
 		}
+	}
 
-		if opts.PullTitle != "" {
-			title = opts.PullTitle
-		}
+	if opts.PullTitle != "" {
+		title = opts.PullTitle
+	}
 
-		if opts.PullBody != "" {
-			body = opts.PullBody
-		}
+	if opts.PullBody != "" {
+		body = opts.PullBody
+	}
+	return
+}
 
-		prSpec := &github.NewPullRequest{
-			Title: &title,
-			Body:  &body,
-			Base:  &baseBranch,
-			Draft: &opts.Draft,
+// finishPullRequest adds metadata and enables auto-merge for a pull request
+// after it is created or updated, recording details in prRes. The pull request
+// exists at this point, so it returns the messages for any failures instead of
+// discarding the result.
+func finishPullRequest(ctx context.Context, client *github.Client, prs *patch2pr.GraphQLPullRequests, repo patch2pr.Repository, pr *patch2pr.PullRequest, prRes *PullRequestResult, opts *Options) []string {
+	var errs []string
+
+	md, _ := pullRequestMetadata(opts)
+	if !md.IsEmpty() {
+		if err := patch2pr.AddPullRequestMetadata(ctx, client, repo, pr.Number, md); err != nil {
+			errs = append(errs, err.Error())
 		}
+	}
 
-		if sourceRepo == targetRepo {
-			prSpec.Head = &headBranch
+	if opts.AutoMerge != "" {
+		method, _ := parseMergeMethod(opts.AutoMerge)
+		if err := prs.EnableAutoMerge(ctx, pr, method); err != nil {
+			errs = append(errs, err.Error())
 		} else {
-			prSpec.Head = github.Ptr(fmt.Sprintf("%s:%s", sourceRepo.Owner, headBranch))
-			prSpec.HeadRepo = &sourceRepo.Name
+			prRes.AutoMerge = strings.ToLower(string(method))
 		}
+	}
 
-		if pr, _, err = client.PullRequests.Create(ctx, targetRepo.Owner, targetRepo.Name, prSpec); err != nil {
-			return nil, fmt.Errorf("create pull request failed: %w", err)
-		}
+	return errs
+}
+
+// waitForChecks waits for the checks on a commit to finish, printing a summary
+// of the results to stderr. It returns an error if the checks fail or do not
+// finish before the timeout.
+func waitForChecks(ctx context.Context, client *github.Client, repo patch2pr.Repository, sha string, timeout time.Duration) (*ChecksResult, error) {
+	const interval = 15 * time.Second
+
+	// Repositories without CI never report checks, so stop waiting if no
+	// checks appear after this long
+	const grace = 2 * time.Minute
+
+	fmt.Fprintf(os.Stderr, "Waiting up to %s for checks on %s...\n", timeout, sha)
+
+	waitCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	checks, err := patch2pr.WaitForChecks(waitCtx, client, repo, sha, interval, grace)
+	if checks == nil {
+		return nil, fmt.Errorf("wait for checks failed: %w", err)
 	}
 
-	res := &Result{
-		Commit: newCommit.GetSHA(),
-		Tree:   newCommit.GetTree().GetSHA(),
+	res := &ChecksResult{State: string(checks.State)}
+	for _, c := range checks.Checks {
+		res.Checks = append(res.Checks, CheckResult{
+			Name:   c.Name,
+			State:  string(c.State),
+			Detail: c.Detail,
+			URL:    c.URL,
+		})
+		fmt.Fprintf(os.Stderr, "  %-8s %s (%s)\n", c.State, c.Name, c.Detail)
 	}
-	if pr != nil {
-		res.PullRequest = &PullRequestResult{
-			Number: pr.GetNumber(),
-			URL:    pr.GetHTMLURL(),
+
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		if len(checks.Checks) == 0 {
+			return res, fmt.Errorf("no checks reported after %s", timeout)
 		}
+		return res, fmt.Errorf("checks did not finish after %s", timeout)
+	case err != nil:
+		return res, fmt.Errorf("wait for checks failed: %w", err)
+	case checks.State == patch2pr.CheckFailure:
+		return res, errors.New("checks failed")
 	}
+
+	if len(checks.Checks) == 0 {
+		fmt.Fprintf(os.Stderr, "No checks reported after %s, assuming there are none\n", grace)
+		return res, nil
+	}
+	fmt.Fprintln(os.Stderr, "All checks passed")
 	return res, nil
 }
 
+// pullRequestSpec returns the spec to create or update a pull request. It only
+// changes the title, body, and draft state of an existing pull request if they
+// were set by flags, so that edits made on GitHub are kept.
+func pullRequestSpec(title, body, base string, opts *Options) patch2pr.PullRequestSpec {
+	return patch2pr.PullRequestSpec{
+		Title:       title,
+		Body:        body,
+		Base:        base,
+		Draft:       opts.Draft,
+		UpdateTitle: opts.PullTitle != "",
+		UpdateBody:  opts.PullBody != "",
+		UpdateDraft: opts.DraftSet,
+	}
+}
+
+// pullRequestMetadata creates the metadata for a pull request from the
+// options. Reviewers in "org/team" format are requested as team reviewers.
+// Pull requests can only request reviews from teams in the organization that
+// owns the repository, so it returns an error for teams in other
+// organizations.
+func pullRequestMetadata(opts *Options) (patch2pr.PullRequestMetadata, error) {
+	md := patch2pr.PullRequestMetadata{
+		Labels:    opts.Labels,
+		Assignees: opts.Assignees,
+		Milestone: opts.Milestone,
+	}
+	for _, r := range opts.Reviewers {
+		org, team, ok := strings.Cut(r, "/")
+		if !ok {
+			md.Reviewers = append(md.Reviewers, r)
+			continue
+		}
+		if opts.Repository != nil && !strings.EqualFold(org, opts.Repository.Owner) {
+			return md, fmt.Errorf("reviewer team %q is not in the organization %q that owns the repository", r, opts.Repository.Owner)
+		}
+		md.TeamReviewers = append(md.TeamReviewers, team)
+	}
+	return md, nil
+}
+
+// getPullRequestForUpdate returns the pull request with the given number if it
+// is open and its head repository still exists.
+func getPullRequestForUpdate(ctx context.Context, client *github.Client, repo patch2pr.Repository, number int) (*github.PullRequest, error) {
+	pr, _, err := client.PullRequests.Get(ctx, repo.Owner, repo.Name, number)
+	if err != nil {
+		return nil, fmt.Errorf("get pull request #%d failed: %w", number, err)
+	}
+	if pr.GetState() != "open" {
+		return nil, fmt.Errorf("pull request #%d is not open", number)
+	}
+	if pr.GetHead().GetRepo() == nil {
+		return nil, fmt.Errorf("pull request #%d head repository no longer exists", number)
+	}
+	return pr, nil
+}
+
+// applyWarnings are the problems found while applying patches that did not
+// stop the patches from applying.
+type applyWarnings struct {
+	fuzzy      []FuzzyResult
+	whitespace []WhitespaceResult
+}
+
+func (w *applyWarnings) append(other applyWarnings) {
+	w.fuzzy = append(w.fuzzy, other.fuzzy...)
+	w.whitespace = append(w.whitespace, other.whitespace...)
+}
+
+// applyPatches applies each patch and creates a commit for it, returning the
+// new commits in order and the hunks and files that did not apply exactly.
+func applyPatches(ctx context.Context, applier *patch2pr.Applier, patches []Patch, opts *Options) ([]*github.Commit, applyWarnings, error) {
+	var newCommits []*github.Commit
+	var warnings applyWarnings
+	for _, patch := range patches {
+		for _, file := range patch.files {
+			if _, err := applier.Apply(ctx, file); err != nil {
+				var namePart string
+				if !errors.Is(err, &patch2pr.Conflict{}) {
+					name := file.NewName
+					if name == "" {
+						name = file.OldName
+					}
+					namePart = name + ": "
+				}
+				return nil, applyWarnings{}, fmt.Errorf("apply failed: %s%w", namePart, err)
+			}
+		}
+
+		matches := applier.FragmentMatches()
+		reports := applier.WhitespaceReports()
+
+		newCommit, err := applier.Commit(ctx, nil, fillHeader(patch.header, patch.path, opts.Message))
+		if err != nil {
+			return nil, applyWarnings{}, fmt.Errorf("commit failed: %w", err)
+		}
+		newCommits = append(newCommits, newCommit)
+
+		for _, m := range matches {
+			fmt.Fprintf(os.Stderr, "warning: %s: hunk #%d at line %d applied with offset %d and fuzz %d\n", m.File, m.Fragment, m.Line, m.Offset, m.Fuzz)
+			warnings.fuzzy = append(warnings.fuzzy, FuzzyResult{
+				Commit: newCommit.GetSHA(),
+				Source: patch.path,
+				File:   m.File,
+				Hunk:   m.Fragment,
+				Line:   m.Line,
+				Offset: m.Offset,
+				Fuzz:   m.Fuzz,
+			})
+		}
+		for _, r := range reports {
+			fmt.Fprintf(os.Stderr, "warning: %s\n", r)
+			warnings.whitespace = append(warnings.whitespace, WhitespaceResult{
+				Commit:             newCommit.GetSHA(),
+				Source:             patch.path,
+				File:               r.File,
+				TrailingWhitespace: r.TrailingWhitespace,
+				BlankAtEOF:         r.BlankAtEOF,
+				IgnoredContext:     r.IgnoredContext,
+				Fixed:              r.Fixed,
+			})
+		}
+	}
+	return newCommits, warnings, nil
+}
+
 func prepareSourceRepo(ctx context.Context, client *github.Client, opts *Options) (patch2pr.Repository, error) {
 	source := patch2pr.Repository{}
 	target := *opts.Repository
@@ -409,6 +1111,39 @@ func createFork(ctx context.Context, client *github.Client, fork, parent patch2p
 	return fmt.Errorf("fork repository was not ready after %s", maxWait)
 }
 
+func parseWhitespaceMode(s string) (patch2pr.WhitespaceMode, error) {
+	switch strings.ToLower(s) {
+	case "", "nowarn":
+		return patch2pr.WhitespaceNoWarn, nil
+	case "warn":
+		return patch2pr.WhitespaceWarn, nil
+	case "fix":
+		return patch2pr.WhitespaceFix, nil
+	case "error":
+		return patch2pr.WhitespaceError, nil
+	}
+	return patch2pr.WhitespaceNoWarn, fmt.Errorf("invalid whitespace mode %q: must be one of nowarn, warn, fix, or error", s)
+}
+
+func parseMergeMethod(s string) (githubv4.PullRequestMergeMethod, error) {
+	switch m := githubv4.PullRequestMergeMethod(strings.ToUpper(s)); m {
+	case githubv4.PullRequestMergeMethodMerge, githubv4.PullRequestMergeMethodSquash, githubv4.PullRequestMergeMethodRebase:
+		return m, nil
+	}
+	return "", fmt.Errorf("invalid merge method %q: must be one of merge, squash, or rebase", s)
+}
+
+// graphQLURL returns the GraphQL API URL for a REST API URL. GitHub.com uses
+// "https://api.github.com/graphql" while GitHub Enterprise Server uses
+// "https://host/api/graphql" with a REST URL of "https://host/api/v3/".
+func graphQLURL(restURL string) string {
+	u := strings.TrimSuffix(restURL, "/")
+	if base, ok := strings.CutSuffix(u, "/v3"); ok {
+		u = base
+	}
+	return u + "/graphql"
+}
+
 func splitMessage(m string) (title string, body string) {
 	s := bufio.NewScanner(strings.NewReader(m))
 
@@ -504,6 +1239,59 @@ Usage: patch2pr [options] [patch...]
   contain a single patch or multiple patches in the mbox format produced by 'git
   format-patch --stdout' or GitHub's patch view.
 
+  A patch argument can also be a directory. For a directory created by 'git
+  format-patch -o', the command reads the '.patch', '.diff', '.mbox', and
+  '.eml' files in order of the number at the start of each file name. For a
+  Maildir, it reads the messages in the 'new' and 'cur' directories in order of
+  delivery. With -json, the output includes the file that contained the patch
+  for each commit.
+
+  Patch files and files in directories may be compressed with gzip or bzip2.
+  A patch file can also be a tar archive, optionally compressed, of the output
+  of 'git format-patch'; the command reads the patch files in the archive in
+  the same order as for a directory. Decompressed input is limited to 256 MiB.
+
+  With -extract, the command finds the diffs in each file in fenced code blocks
+  marked as 'diff' or 'patch', in unmarked code blocks that contain diffs, and
+  in the text itself, and applies them as one commit per file. It repairs
+  blank context lines with missing leading spaces and context lines that
+  start with non-breaking spaces. With -json, the output includes the lines
+  of each diff and the number of lines repaired.
+
+  By default, each hunk must match the file exactly at the line in the patch.
+  With -max-offset and -fuzz, the command applies hunks that moved or that
+  have different context lines, like GNU patch, and prints the offset and
+  fuzz of each of these hunks. With -json, the output includes them too.
+
+  With -whitespace, the command checks the lines added by each patch for
+  trailing whitespace and blank lines at the end of a file, like 'git apply',
+  and can warn about them, remove them, or fail. With -ignore-whitespace,
+  context lines match lines in the file that differ only in whitespace. With
+  -json, the output includes the number of lines with problems in each file.
+
+  Patches apply to files with CRLF line endings even if the patch uses LF, or
+  the reverse. Like Git, files with the 'text' or 'eol' attributes in the
+  repository's .gitattributes files are stored with LF, and files without
+  attributes that use CRLF keep CRLF in the lines added by the patch.
+
+  Patches in email messages may use quoted-printable or base64 encoding, have
+  encoded headers, use character sets other than UTF-8, or be attachments to
+  a multipart message. Like 'git am', the command converts the headers and
+  message text to UTF-8, but not the diff. If an attachment contains a
+  complete patch email, like a file created by 'git format-patch', the command
+  applies the patch from the attachment and ignores the message that contains
+  it.
+
+  If the patches are numbered, like '[PATCH v2 3/5]', the command applies them
+  in order of their numbers, even if they are in different files or out of
+  order in the same file, and fails if any patches are missing or duplicated.
+  The numbers are removed from the commit titles.
+
+  If the patches include a cover letter, like the '[PATCH 0/N]' message
+  produced by 'git format-patch --cover-letter', the command does not apply it
+  and instead uses its subject and body as the default title and body of the
+  pull request.
+
   By default, patch2pr uses the patch header for author and committer
   information, falling back to the authenticated GitHub user if the headers are
   missing or invalid. Callers can override these values using the standard Git
@@ -518,16 +1306,48 @@ Usage: patch2pr [options] [patch...]
 
   Override the commit message by using the -message flag.
 
+  The -label, -reviewer, -assignee, -milestone, and -auto-merge flags add
+  details to the pull request after it is created. If adding any of these
+  fails, the command reports the failures and exits with a non-zero status, but
+  does not remove the pull request or the other details.
+
   With the -fork and -fork-repository flags, the command can submit the pull
   request from a fork repository. If an existing fork does not exist, the
   command creates a new fork, which may take up to five minutes.
 
+  If an open pull request already exists for the head branch, the command
+  uses it instead of creating a new pull request. It only changes the title,
+  body, or draft state of the existing pull request if set by -pull-title,
+  -pull-body, or -draft.
+
+  If the patches are a new revision of a series, with a subject prefix like
+  '[PATCH v2]', and the open pull request for the head branch has the same
+  title, the command replaces the commits on the head branch even without the
+  -force flag. It then comments on the pull request with a comparison of the
+  previous and new commits in the style of 'git range-diff'.
+
 Options:
 
+  -assignee=user         Assign a user to the pull request. May be repeated or
+                         contain a comma-separated list of users.
+
+  -auto-merge=method     Enable auto-merge for the pull request using the merge
+                         method, one of 'merge', 'squash', or 'rebase'. The
+                         repository must allow auto-merge.
+
   -base-branch=branch    The branch to target with the pull request. If unset,
                          use the repository's default branch.
 
-  -draft                 Create a draft pull request.
+  -draft                 Create a draft pull request. If a pull request for the
+                         head branch exists, convert it to a draft, or with
+                         -draft=false, mark it ready for review. If unset, do
+                         not change the draft state of an existing pull
+                         request.
+
+  -extract               Find diffs in Markdown or plain text, like an issue
+                         body or a chat message, instead of reading the patch
+                         files as patches or emails. Repair common whitespace
+                         damage and print the lines of each diff used.
 
   -force                 Update the head branch even if it exists and is not a
                          fast-forward.
@@ -541,38 +1361,137 @@ Options:
                          pushing directly to the repository, creating the fork
                          if it does not exist. Implies the -fork flag.
 
+  -fuzz=n                Apply hunks that do not match the file after
+                         ignoring up to n lines of context at the start and
+                         end of the hunk, like the fuzz factor of GNU patch.
+                         Print a warning for each hunk that does not match
+                         exactly. If unset, all context must match.
+
   -head-branch=branch    The branch to create or update with the new commit. If
                          unset, use 'patch2pr'.
 
+  -ignore-whitespace     Match context lines that differ from the file only in
+                         the amount of whitespace, like the --ignore-whitespace
+                         flag of 'git apply'. Keep the whitespace of the file
+                         in these lines.
+
   -json                  Output information about the new commit and pull request
                          in JSON format.
 
+  -label=label           Add a label to the pull request. May be repeated or
+                         contain a comma-separated list of labels.
+
+  -max-offset=n          Apply hunks that do not match the file at the line in
+                         the patch if they match up to n lines before or after
+                         it. Print a warning for each hunk that does not match
+                         exactly. If unset, hunks must match at their lines.
+
+  -mbox-format=format    The mbox variant of the patch files, one of 'mboxo',
+                         'mboxrd', or 'mboxcl2'. With 'mboxo' and 'mboxrd',
+                         remove the '>' added to body lines that start with
+                         'From '. With 'mboxcl2', use the Content-Length header
+                         to find the end of each message. If unset or 'auto',
+                         unescape lines like 'mboxrd' and use Content-Length
+                         headers that match the start of the next message.
+
   -message=message       Message for the commit. Overrides the patch header.
 
+  -milestone=milestone   Add the pull request to a milestone, identified by
+                         the title of an open milestone or by number. If an
+                         open milestone has a title that is a number, like
+                         '2024', use that milestone.
+
   -no-pull-request       Do not create a pull request after creating a commit.
 
+  -partial-series        Allow numbered patches to be missing from a series,
+                         like when applying only patch 3 of 5.
+
   -patch-base=base       Base commit to apply the patch to. Can be a SHA1, a
                          branch, or a tag. Branches and tags must start with
                          'refs/heads/' or 'refs/tags/' respectively. If unset,
                          use the repository's default branch.
 
   -pull-body=body        The body for the pull request. If unset, use the body of
-                         the commit message.
+                         the commit message. Only replaces the body of an
+                         existing pull request if set.
 
   -pull-title=title      The title for the pull request. If unset, use the title
-                         of the commit message.
+                         of the commit message. Only replaces the title of an
+                         existing pull request if set.
+
+  -rebase-retries=n      If the head branch exists and updating it is not a
+                         fast-forward, re-apply the patches on top of the
+                         current head branch and try again, up to n times.
+                         Ignored with -force. If unset, do not retry.
+
+  -recount               Ignore the line counts in hunk headers and count the
+                         lines in each hunk instead, like 'git apply
+                         --recount'. Use this for patches that were edited by
+                         hand. Print a warning for each hunk with wrong counts.
 
   -repository=repo       Repository to apply the patch to in 'owner/name' format.
                          Required.
 
+  -reviewer=reviewer     Request a review from a user or from a team in
+                         'org/team' format, where org must own the
+                         repository. May be repeated or contain a
+                         comma-separated list of reviewers.
+
+  -series=path           Apply the patches listed in a quilt series file instead
+                         of reading patch files from the arguments. Each line
+                         of the series file names a patch relative to the
+                         directory of the series file and may set a strip
+                         level like '-p0'. Git diffs do not support '-p0'.
+                         Each patch becomes its own commit, titled with the
+                         description at the start of the patch or the name of
+                         the patch file.
+
+  -stack                 Create a separate branch and pull request for each
+                         patch instead of a single pull request for all
+                         patches. Branches are named after the head branch
+                         with a numeric suffix, like 'patch2pr-1', and each
+                         pull request targets the branch of the previous
+                         patch. Pull request bodies include a table linking to
+                         all pull requests in the stack. If a previous version
+                         of the stack had more patches, closes the open pull
+                         requests for the extra branches, but does not delete
+                         the branches. Ignores -pull-title, -pull-body, and
+                         -rebase-retries.
+
   -token=token           GitHub API token with 'repo' scope for authentication.
                          If unset, use the value of the GITHUB_TOKEN environment
                          variable.
 
+  -update-pull-request=n Apply the patches on top of the head branch of the
+                         existing pull request with number n and append the
+                         new commits to the branch. The pull request may come
+                         from a fork if it allows edits from maintainers.
+                         Ignores -head-branch, -base-branch, -pull-title, and
+                         -pull-body. Cannot be used with -fork, -force,
+                         -patch-base, or -no-pull-request.
+
   -url=url               GitHub API URL. If unset, use https://api.github.com.
+                         The command also uses the GraphQL API at the matching
+                         URL, like https://api.github.com/graphql, to create
+                         and update pull requests.
 
   -v/-version            Print the version and exit.
 
+  -wait                  After pushing the commit, wait for commit statuses and
+                         check runs to finish and print a summary. Exit with a
+                         non-zero status if any check fails or if the checks
+                         do not finish before the timeout. If no checks are
+                         reported after 2 minutes, assume there are none.
+
+  -wait-timeout=duration The maximum time to wait with -wait, like '10m'. If
+                         unset, wait up to 30 minutes.
+
+  -whitespace=mode       How to handle trailing whitespace and blank lines at
+                         the end of a file in added lines. One of 'nowarn',
+                         'warn' to print a warning, 'fix' to remove them and
+                         print a warning, or 'error' to fail. If unset, use
+                         'nowarn'.
+
 `
 	return strings.TrimSpace(help)
 }
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/bluekeyes/patch2pr"
+	"github.com/google/go-github/v89/github"
+	"github.com/shurcooL/githubv4"
+)
+
+func TestGraphQLURL(t *testing.T) {
+	tests := map[string]string{
+		"https://api.github.com/":            "https://api.github.com/graphql",
+		"https://api.github.com":             "https://api.github.com/graphql",
+		"https://github.example.com/api/v3/": "https://github.example.com/api/graphql",
+		"https://github.example.com/api/v3":  "https://github.example.com/api/graphql",
+	}
+
+	for restURL, expected := range tests {
+		if got := graphQLURL(restURL); got != expected {
+			t.Errorf("incorrect URL for %q: expected %q, got %q", restURL, expected, got)
+		}
+	}
+}
+
+func TestPullRequestMetadata(t *testing.T) {
+	opts := &Options{
+		Repository: &patch2pr.Repository{Owner: "org", Name: "repo"},
+		Reviewers:  []string{"user", "org/team", "other-user", "Org/other-team"},
+	}
+	md, err := pullRequestMetadata(opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if want := []string{"user", "other-user"}; !slices.Equal(md.Reviewers, want) {
+		t.Errorf("incorrect reviewers: want %v, got %v", want, md.Reviewers)
+	}
+	if want := []string{"team", "other-team"}; !slices.Equal(md.TeamReviewers, want) {
+		t.Errorf("incorrect team reviewers: want %v, got %v", want, md.TeamReviewers)
+	}
+
+	opts.Reviewers = []string{"user", "other-org/team"}
+	if _, err := pullRequestMetadata(opts); err == nil {
+		t.Error("expected error for team in other organization, but got nil")
+	}
+}
+
+func TestPullRequestSpec(t *testing.T) {
+	tests := map[string]struct {
+		Opts     Options
+		Expected patch2pr.PullRequestSpec
+	}{
+		"defaults": {
+			Opts:     Options{},
+			Expected: patch2pr.PullRequestSpec{Title: "title", Body: "body", Base: "main"},
+		},
+		"flags": {
+			Opts: Options{PullTitle: "title", PullBody: "body", Draft: true, DraftSet: true},
+			Expected: patch2pr.PullRequestSpec{
+				Title:       "title",
+				Body:        "body",
+				Base:        "main",
+				Draft:       true,
+				UpdateTitle: true,
+				UpdateBody:  true,
+				UpdateDraft: true,
+			},
+		},
+		"draftFalse": {
+			Opts:     Options{DraftSet: true},
+			Expected: patch2pr.PullRequestSpec{Title: "title", Body: "body", Base: "main", UpdateDraft: true},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := pullRequestSpec("title", "body", "main", &test.Opts); got != test.Expected {
+				t.Errorf("incorrect spec:\nexpected: %+v\n  actual: %+v", test.Expected, got)
+			}
+		})
+	}
+}
+
+func TestExecuteUpdatePullRequest(t *testing.T) {
+	const (
+		headSHA   = "1111111111111111111111111111111111111111"
+		treeSHA   = "2222222222222222222222222222222222222222"
+		commitSHA = "3333333333333333333333333333333333333333"
+	)
+
+	const patch = `From 0000000000000000000000000000000000000000 Mon Sep 17 00:00:00 2001
+From: Jane Doe <jane@example.com>
+Date: Mon, 1 Jan 2024 00:00:00 +0000
+Subject: [PATCH] Add follow-up file
+
+---
+ followup.txt | 1 +
+ 1 file changed, 1 insertion(+)
+ create mode 100644 followup.txt
+
+diff --git a/followup.txt b/followup.txt
+new file mode 100644
+index 0000000..ce01362
+--- /dev/null
++++ b/followup.txt
+@@ -0,0 +1 @@
++hello
+--
+2.43.0
+`
+
+	patchFile := filepath.Join(t.TempDir(), "followup.patch")
+	if err := os.WriteFile(patchFile, []byte(patch), 0o644); err != nil {
+		t.Fatalf("unexpected error writing patch: %v", err)
+	}
+
+	var refUpdate map[string]any
+	var repoQuery map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := r.Method + " " + r.URL.Path
+		switch route {
+		case "GET /repos/o/r/pulls/7":
+			fmt.Fprintf(w, `{
+				"number": 7,
+				"node_id": "PR_7",
+				"state": "open",
+				"html_url": "https://github.com/o/r/pull/7",
+				"title": "Existing title",
+				"base": {"ref": "main"},
+				"head": {"ref": "feature", "sha": %q, "repo": {"name": "fork", "owner": {"login": "contributor"}}}
+			}`, headSHA)
+		case "GET /repos/contributor/fork/git/commits/" + headSHA:
+			fmt.Fprintf(w, `{"sha": %q, "tree": {"sha": %q}}`, headSHA, treeSHA)
+		case "GET /repos/contributor/fork/git/trees/" + treeSHA:
+			fmt.Fprintf(w, `{"sha": %q, "tree": []}`, treeSHA)
+		case "GET /repos/contributor/fork/branches/feature":
+			fmt.Fprint(w, `{"name": "feature", "protected": false}`)
+		case "POST /repos/contributor/fork/git/blobs":
+			fmt.Fprint(w, `{"sha": "4444444444444444444444444444444444444444"}`)
+		case "POST /repos/contributor/fork/git/trees":
+			fmt.Fprint(w, `{"sha": "5555555555555555555555555555555555555555"}`)
+		case "POST /repos/contributor/fork/git/commits":
+			fmt.Fprintf(w, `{"sha": %q, "tree": {"sha": "5555555555555555555555555555555555555555"}}`, commitSHA)
+
+		case "POST /graphql":
+			var req struct {
+				Query     string
+				Variables map[string]any
+			}
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				t.Errorf("invalid request: %v", err)
+			}
+			switch {
+			case strings.HasSuffix(req.Query, "{repository(owner: $owner, name: $name){id}}"):
+				repoQuery = req.Variables
+				fmt.Fprint(w, `{"data": {"repository": {"id": "R_fork"}}}`)
+			case strings.Contains(req.Query, "updateRefs("):
+				input, _ := req.Variables["input"].(map[string]any)
+				if updates, ok := input["refUpdates"].([]any); ok && len(updates) == 1 {
+					refUpdate, _ = updates[0].(map[string]any)
+				}
+				fmt.Fprint(w, `{"data": {"updateRefs": {"clientMutationId": null}}}`)
+			default:
+				t.Errorf("unexpected GraphQL request: %s", req.Query)
+				fmt.Fprint(w, `{"errors": [{"message": "unexpected request"}]}`)
+			}
+
+		default:
+			t.Errorf("unexpected request: %s", route)
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"message": "Not Found"}`)
+		}
+	}))
+	defer srv.Close()
+
+	client, err := github.NewClient(github.WithURLs(github.Ptr(srv.URL+"/"), nil))
+	if err != nil {
+		t.Fatalf("unexpected error creating client: %v", err)
+	}
+	v4client := githubv4.NewEnterpriseClient(srv.URL+"/graphql", srv.Client())
+
+	opts := &Options{
+		Repository:        &patch2pr.Repository{Owner: "o", Name: "r"},
+		HeadBranch:        "patch2pr",
+		UpdatePullRequest: 7,
+	}
+
+	res, err := execute(t.Context(), client, v4client, []string{patchFile}, opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if res.Commit != commitSHA {
+		t.Errorf("incorrect commit: expected %q, actual %q", commitSHA, res.Commit)
+	}
+	if res.PullRequest == nil {
+		t.Fatal("expected pull request result, but got nil")
+	}
+	if res.PullRequest.Number != 7 || !res.PullRequest.Updated {
+		t.Errorf("incorrect pull request: expected updated #7, actual %+v", res.PullRequest)
+	}
+
+	if repoQuery["owner"] != "contributor" || repoQuery["name"] != "fork" {
+		t.Errorf("incorrect repository for ref update: %v", repoQuery)
+	}
+
+	expectedUpdate := map[string]any{
+		"name":      "refs/heads/feature",
+		"afterOid":  commitSHA,
+		"beforeOid": headSHA,
+		"force":     false,
+	}
+	for k, v := range expectedUpdate {
+		if refUpdate[k] != v {
+			t.Errorf("incorrect ref update %s: expected %v, actual %v", k, v, refUpdate[k])
+		}
+	}
+}
@@ -1,14 +1,65 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
+	"errors"
+	"fmt"
 	"io"
+	"strconv"
+	"strings"
 )
 
+// mboxFormat is a variant of the mbox format. The variants differ in how they
+// separate messages and how they escape lines in message bodies that could be
+// mistaken for separators.
+type mboxFormat int
+
+const (
+	// mboxAuto splits messages on "From " lines, unescapes quoted lines like
+	// mboxrd, and uses the Content-Length header like mboxcl2 when the header
+	// matches the position of the next message.
+	mboxAuto mboxFormat = iota
+
+	// mboxO splits messages on "From " lines and unescapes ">From " lines.
+	mboxO
+
+	// mboxRD splits messages on "From " lines and removes one ">" from lines
+	// that start with one or more ">" followed by "From ".
+	mboxRD
+
+	// mboxCL2 uses the Content-Length header to find the end of each message
+	// and does not unescape any lines.
+	mboxCL2
+)
+
+func parseMBoxFormat(s string) (mboxFormat, error) {
+	switch strings.ToLower(s) {
+	case "", "auto":
+		return mboxAuto, nil
+	case "mboxo":
+		return mboxO, nil
+	case "mboxrd":
+		return mboxRD, nil
+	case "mboxcl2":
+		return mboxCL2, nil
+	}
+	return mboxAuto, fmt.Errorf("invalid mbox format %q: must be one of 'auto', 'mboxo', 'mboxrd', or 'mboxcl2'", s)
+}
+
 var (
 	mboxHeader = []byte("From ")
 )
 
+const (
+	// The size of the read buffer, which limits the size of messages that
+	// mboxAuto can check against their Content-Length headers
+	mboxBufferSize = 1 << 20
+
+	// The maximum amount of a mboxcl2 message body returned by one read
+	mboxChunkSize = 32 * 1024
+)
+
 type fileType int
 
 const (
@@ -17,108 +68,276 @@ const (
 	fileMBox
 )
 
+// mboxMessageReader splits an input stream into messages. Call Next to advance
+// to the next message and then Read to read the content of that message. If
+// the input is not in mbox format, the whole input is a single message.
 type mboxMessageReader struct {
-	r    io.Reader
-	next bytes.Buffer
+	r      *bufio.Reader
+	format mboxFormat
+	ftype  fileType
+
+	// The remaining content of the current line
+	out []byte
+	// A line read from the input that belongs to the next message
+	pending []byte
+
+	active    bool
+	done      bool
+	started   bool
+	inHeaders bool
+	afterBody bool
 
-	headers int
-	ftype   fileType
+	contentLength int
+	remaining     int
 
-	isLineStart bool
-	isEOF       bool
+	isEOF bool
+	err   error
 }
 
+func newMBoxMessageReader(r io.Reader, format mboxFormat) *mboxMessageReader {
+	return &mboxMessageReader{
+		r:      bufio.NewReaderSize(r, mboxBufferSize),
+		format: format,
+	}
+}
+
+// Next advances to the next message, discarding any unread content of the
+// current message. It returns false if there are no more messages.
 func (r *mboxMessageReader) Next() bool {
-	if r.isEOF && r.bufferEmpty() {
+	for r.active && !r.done && r.err == nil {
+		r.out = nil
+		r.fill()
+	}
+	if r.err != nil || (r.isEOF && r.pending == nil) {
 		return false
 	}
 
-	r.headers = 0
-	r.isLineStart = true
+	r.active = true
+	r.done = false
+	r.started = false
+	r.inHeaders = false
+	r.afterBody = false
+	r.contentLength = -1
+	r.remaining = 0
+	r.out = nil
 	return true
 }
 
-func (r *mboxMessageReader) Read(p []byte) (n int, err error) {
-	// TODO(bkeyes): This is broken if it is only called with len(p) < len(mboxHeader).
-	// This shouldn't be a problem in practice because go-gitdiff always wraps
-	// the input reader in a bufio.Reader, which uses a large enough buffer.
+// Err returns the first error that happened while reading the input.
+func (r *mboxMessageReader) Err() error {
+	return r.err
+}
 
+func (r *mboxMessageReader) Read(p []byte) (n int, err error) {
 	if len(p) == 0 {
 		return 0, nil
 	}
-	if r.headers > 1 || (r.isEOF && r.bufferEmpty()) {
+
+	for n < len(p) {
+		if len(r.out) > 0 {
+			c := copy(p[n:], r.out)
+			r.out = r.out[c:]
+			n += c
+			continue
+		}
+		if r.done || r.err != nil {
+			break
+		}
+		r.fill()
+	}
+
+	if n == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
 		return 0, io.EOF
 	}
+	return n, nil
+}
 
-	if !r.bufferEmpty() {
-		n, _ = r.next.Read(p)
-		if r.bufferEmpty() {
-			r.next.Reset()
+// fill sets out to the next content of the current message or marks the
+// message as done.
+func (r *mboxMessageReader) fill() {
+	if r.remaining > 0 {
+		chunk := make([]byte, min(r.remaining, mboxChunkSize))
+		n, err := io.ReadFull(r.r, chunk)
+		r.out = chunk[:n]
+		r.remaining -= n
+		r.afterBody = r.remaining == 0
+		if err != nil {
+			r.setErr(fmt.Errorf("mboxcl2 message is shorter than its Content-Length: %w", err))
 		}
+		return
 	}
-	if n < len(p) {
-		var nn int
-		nn, err = r.r.Read(p[n:])
-		if err == io.EOF {
-			r.isEOF = true
-			err = nil
+
+	line, ok := r.readLine()
+	if !ok {
+		r.done = true
+		return
+	}
+
+	if r.ftype == filePlain {
+		r.out = line
+		return
+	}
+
+	if isFromLine(line) {
+		if r.started {
+			r.pending = line
+			r.done = true
+			return
 		}
-		n += nn
+		r.ftype = fileMBox
+		r.started = true
+		r.inHeaders = true
+		r.out = line
+		return
 	}
 
-	if r.ftype == fileUnknown || r.ftype == fileMBox {
-		n = r.scanForHeader(p, n)
+	if r.ftype == fileUnknown {
+		if len(bytes.TrimSpace(line)) > 0 {
+			r.ftype = filePlain
+		}
+		r.out = line
+		return
 	}
 
-	return n, err
+	if r.afterBody && isBlankLine(line) {
+		// Skip the blank lines between the end of a body with a known length
+		// and the next message
+		return
+	}
+
+	if r.inHeaders {
+		r.readHeader(line)
+		r.out = line
+		return
+	}
+
+	r.out = r.unescape(line)
 }
 
-func (r *mboxMessageReader) scanForHeader(p []byte, n int) int {
-	for i := range n {
-		if isSpace(p[i]) {
-			r.isLineStart = p[i] == '\n'
-			continue
+func (r *mboxMessageReader) readHeader(line []byte) {
+	if isBlankLine(line) {
+		r.inHeaders = false
+		if r.contentLength >= 0 && r.useContentLength(r.contentLength) {
+			r.remaining = r.contentLength
+			r.afterBody = r.remaining == 0
 		}
+		return
+	}
 
-		if r.isLineStart {
-			if matchLen := matchMBoxHeader(p[i:n]); matchLen > 0 {
-				if matchLen == len(mboxHeader) {
-					r.ftype = fileMBox
-					r.headers++
-				}
-				if r.headers > 1 || matchLen < len(mboxHeader) {
-					r.next.Write(p[i:n])
-					return i
-				}
-			}
+	if r.format != mboxAuto && r.format != mboxCL2 {
+		return
+	}
+	if name, value, ok := strings.Cut(string(line), ":"); ok && strings.EqualFold(strings.TrimSpace(name), "Content-Length") {
+		if n, err := strconv.Atoi(strings.TrimSpace(value)); err == nil && n >= 0 {
+			r.contentLength = n
 		}
+	}
+}
 
-		if r.ftype == fileUnknown {
-			r.ftype = filePlain
-			break
-		}
+// useContentLength returns true if the message body has the length n. In
+// mboxAuto, this is only true if the body is followed by the end of the input
+// or the next message.
+func (r *mboxMessageReader) useContentLength(n int) bool {
+	if r.format == mboxCL2 {
+		return true
 	}
-	return n
+	if r.format != mboxAuto {
+		return false
+	}
+
+	// Peek fails with bufio.ErrBufferFull if the body is larger than the
+	// buffer, in which case the length is not used
+	b, err := r.r.Peek(n + 4 + len(mboxHeader))
+	if (err != nil && !errors.Is(err, io.EOF)) || len(b) < n {
+		return false
+	}
+
+	rest := bytes.TrimLeft(b[n:], "\r\n")
+	if len(rest) == 0 {
+		return err != nil
+	}
+	return bytes.HasPrefix(rest, mboxHeader)
 }
 
-func (r *mboxMessageReader) bufferEmpty() bool {
-	return r.next.Len() == 0
+func (r *mboxMessageReader) unescape(line []byte) []byte {
+	switch r.format {
+	case mboxO:
+		if bytes.HasPrefix(line, []byte(">From ")) {
+			return line[1:]
+		}
+	case mboxAuto, mboxRD:
+		quoted := bytes.TrimLeft(line, ">")
+		if len(quoted) < len(line) && bytes.HasPrefix(quoted, mboxHeader) {
+			return line[1:]
+		}
+	}
+	return line
 }
 
-func matchMBoxHeader(b []byte) (n int) {
-	for n < len(b) && n < len(mboxHeader) {
-		if b[n] != mboxHeader[n] {
-			return 0
+func (r *mboxMessageReader) readLine() ([]byte, bool) {
+	if r.pending != nil {
+		line := r.pending
+		r.pending = nil
+		return line, true
+	}
+	if r.isEOF {
+		return nil, false
+	}
+
+	line, err := r.r.ReadBytes('\n')
+	if err != nil {
+		if err != io.EOF {
+			r.setErr(err)
+			return nil, false
 		}
-		n++
+		r.isEOF = true
 	}
-	return n
+	return line, len(line) > 0
 }
 
-func isSpace(b byte) bool {
-	switch b {
-	case ' ', '\t', '\r', '\n':
-		return true
+func (r *mboxMessageReader) setErr(err error) {
+	if r.err == nil {
+		r.err = err
+	}
+}
+
+// isFromLine returns true if the line is an mbox message separator. Like 'git
+// mailsplit', it requires that the line ends with a date so that body lines
+// that happen to start with "From " are not mistaken for separators.
+func isFromLine(line []byte) bool {
+	line = bytes.TrimRight(line, "\r\n")
+	if len(line) < 20 || !bytes.HasPrefix(line, mboxHeader) {
+		return false
+	}
+
+	colon := bytes.LastIndexByte(line[len(mboxHeader):], ':')
+	if colon < 0 {
+		return false
 	}
-	return false
+	colon += len(mboxHeader)
+
+	// Look for a time ("hh:mm:ss") followed by a year
+	if colon < 4 || colon+3 > len(line) {
+		return false
+	}
+	for _, i := range []int{colon - 4, colon - 2, colon - 1, colon + 1, colon + 2} {
+		if !isDigit(line[i]) {
+			return false
+		}
+	}
+
+	year, _, _ := strings.Cut(strings.TrimSpace(string(line[colon+3:])), " ")
+	y, err := strconv.Atoi(year)
+	return err == nil && y > 90
+}
+
+func isBlankLine(line []byte) bool {
+	return len(bytes.TrimSpace(line)) == 0
+}
+
+func isDigit(b byte) bool {
+	return '0' <= b && b <= '9'
 }
@@ -16,6 +16,8 @@ func TestMBoxMessageReader(t *testing.T) {
 
 	tests := map[string]struct {
 		File            string
+		Format          mboxFormat
+		ReadSize        int
 		Count           int
 		ExpectedContent map[int]string
 	}{
@@ -55,6 +57,79 @@ This is the last message in the file.
 			Count:           1,
 			ExpectedContent: map[int]string{0: string(plainMessage)},
 		},
+		"shortReads": {
+			File:     "testdata/test.mbox",
+			ReadSize: 1,
+			Count:    5,
+			ExpectedContent: map[int]string{
+				2: `From e32a4a21b36ccee78e91aa13933388a976bbd9da Mon Sep 17 00:00:00 2001
+
+`,
+			},
+		},
+		"mboxrd": {
+			File:   "testdata/test.mboxrd",
+			Format: mboxRD,
+			Count:  2,
+			ExpectedContent: map[int]string{
+				0: `From 5255ca3071e33871ad7c23de1a3962f19b215f74 Mon Sep 17 00:00:00 2001
+Subject: first
+
+From the start, this line was quoted
+>From this line was quoted twice
+From the body, a line that is not a separator
+> From a reply
+
+`,
+			},
+		},
+		"mboxo": {
+			File:   "testdata/test.mboxrd",
+			Format: mboxO,
+			Count:  2,
+			ExpectedContent: map[int]string{
+				0: `From 5255ca3071e33871ad7c23de1a3962f19b215f74 Mon Sep 17 00:00:00 2001
+Subject: first
+
+From the start, this line was quoted
+>>From this line was quoted twice
+From the body, a line that is not a separator
+> From a reply
+
+`,
+			},
+		},
+		"mboxcl2": {
+			File:   "testdata/test.mboxcl2",
+			Format: mboxCL2,
+			Count:  2,
+			ExpectedContent: map[int]string{
+				0: `From 5255ca3071e33871ad7c23de1a3962f19b215f74 Mon Sep 17 00:00:00 2001
+Subject: first
+Content-Length: 71
+
+From 5a900b1a1f8b3e4244127bff85a5fd2d82ae2ced Mon Sep 17 00:00:00 2001
+`,
+				1: `From 5a900b1a1f8b3e4244127bff85a5fd2d82ae2ced Mon Sep 17 00:00:00 2001
+Subject: second
+Content-Length: 17
+
+>From the second
+`,
+			},
+		},
+		"mboxcl2Auto": {
+			File:  "testdata/test.mboxcl2",
+			Count: 2,
+			ExpectedContent: map[int]string{
+				1: `From 5a900b1a1f8b3e4244127bff85a5fd2d82ae2ced Mon Sep 17 00:00:00 2001
+Subject: second
+Content-Length: 17
+
+>From the second
+`,
+			},
+		},
 	}
 
 	for name, test := range tests {
@@ -65,11 +140,16 @@ This is the last message in the file.
 			}
 			defer f.Close()
 
-			mbr := mboxMessageReader{r: f}
+			mbr := newMBoxMessageReader(f, test.Format)
 
 			var msgs []string
 			for i := 0; mbr.Next(); i++ {
-				b, err := io.ReadAll(&mbr)
+				var r io.Reader = mbr
+				if test.ReadSize > 0 {
+					r = &limitedReadSizeReader{mbr, test.ReadSize}
+				}
+
+				b, err := io.ReadAll(r)
 				if err != nil {
 					t.Fatalf("unexpected error reading message %d: %v", i+1, err)
 				}
@@ -84,6 +164,36 @@ This is the last message in the file.
 	}
 }
 
+func TestIsFromLine(t *testing.T) {
+	tests := map[string]bool{
+		"From 5255ca3071e33871ad7c23de1a3962f19b215f74 Mon Sep 17 00:00:00 2001\n":  true,
+		"From test@example.com Thu Jan  1 00:00:00 1970\r\n":                        true,
+		"From the body, a line that is not a separator\n":                           false,
+		"From: Test <test@example.com>\n":                                           false,
+		">From 5255ca3071e33871ad7c23de1a3962f19b215f74 Mon Sep 17 00:00:00 2001\n": false,
+		"From test Mon Sep 17 00:00:00 19\n":                                        false,
+	}
+
+	for line, expected := range tests {
+		if got := isFromLine([]byte(line)); got != expected {
+			t.Errorf("incorrect result for %q: expected %t, got %t", line, expected, got)
+		}
+	}
+}
+
+// limitedReadSizeReader reads at most n bytes in each call to Read
+type limitedReadSizeReader struct {
+	r io.Reader
+	n int
+}
+
+func (r *limitedReadSizeReader) Read(p []byte) (int, error) {
+	if len(p) > r.n {
+		p = p[:r.n]
+	}
+	return r.r.Read(p)
+}
+
 func assertMsgCount(t *testing.T, msgs []string, count int) {
 	if len(msgs) != count {
 		msgStrs := make([]string, len(msgs))
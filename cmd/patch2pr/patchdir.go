@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// patchFileExts are the extensions of files read from a directory that is not
+// a Maildir or from an archive. Other files, like editor backups or notes, are
+// ignored.
+var patchFileExts = []string{".patch", ".diff", ".mbox", ".eml"}
+
+// expandPatchFiles replaces any directories in paths with the patch files
+// they contain, in the order the patches should be applied. Other paths are
+// returned unchanged.
+func expandPatchFiles(paths []string) ([]string, error) {
+	var expanded []string
+	for _, p := range paths {
+		if p == "-" {
+			expanded = append(expanded, p)
+			continue
+		}
+
+		info, err := os.Stat(p)
+		if err != nil {
+			return nil, fmt.Errorf("open patch file failed: %w", err)
+		}
+		if !info.IsDir() {
+			expanded = append(expanded, p)
+			continue
+		}
+
+		var files []string
+		if isMaildir(p) {
+			files, err = listMaildir(p)
+		} else {
+			files, err = listPatchDir(p)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(files) == 0 {
+			return nil, fmt.Errorf("directory %s does not contain any patches", p)
+		}
+		expanded = append(expanded, files...)
+	}
+	return expanded, nil
+}
+
+func isMaildir(dir string) bool {
+	for _, sub := range []string{"cur", "new"} {
+		if info, err := os.Stat(filepath.Join(dir, sub)); err == nil && info.IsDir() {
+			return true
+		}
+	}
+	return false
+}
+
+// listMaildir returns the messages in the "new" and "cur" directories of a
+// Maildir ordered by delivery time, which is the first part of each name.
+func listMaildir(dir string) ([]string, error) {
+	var files []string
+	for _, sub := range []string{"cur", "new"} {
+		entries, err := os.ReadDir(filepath.Join(dir, sub))
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, fmt.Errorf("read maildir failed: %w", err)
+		}
+		for _, e := range entries {
+			if e.Type().IsRegular() && !strings.HasPrefix(e.Name(), ".") {
+				files = append(files, filepath.Join(dir, sub, e.Name()))
+			}
+		}
+	}
+
+	slices.SortStableFunc(files, func(a, b string) int {
+		return compareNumericPrefix(filepath.Base(a), filepath.Base(b))
+	})
+	return files, nil
+}
+
+// listPatchDir returns the patch files in a directory, like the output of
+// 'git format-patch -o', ordered by the number at the start of each name.
+func listPatchDir(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("read patch directory failed: %w", err)
+	}
+
+	var files []string
+	for _, e := range entries {
+		name := e.Name()
+		if !e.Type().IsRegular() || strings.HasPrefix(name, ".") {
+			continue
+		}
+		if isPatchFileName(name) {
+			files = append(files, filepath.Join(dir, name))
+		}
+	}
+
+	slices.SortStableFunc(files, func(a, b string) int {
+		return compareNumericPrefix(filepath.Base(a), filepath.Base(b))
+	})
+	return files, nil
+}
+
+// compareNumericPrefix orders names by the number at the start of each name.
+// Names without a number come after names with a number. Names with the same
+// number, or without numbers, are ordered by name.
+func compareNumericPrefix(a, b string) int {
+	na, aok := numericPrefix(a)
+	nb, bok := numericPrefix(b)
+	switch {
+	case aok && bok && na != nb:
+		if na < nb {
+			return -1
+		}
+		return 1
+	case aok && !bok:
+		return -1
+	case !aok && bok:
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+func numericPrefix(name string) (uint64, bool) {
+	end := 0
+	for end < len(name) && isDigit(name[end]) {
+		end++
+	}
+	n, err := strconv.ParseUint(name[:end], 10, 64)
+	return n, err == nil
+}
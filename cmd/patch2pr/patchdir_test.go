@@ -0,0 +1,80 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestExpandPatchFiles(t *testing.T) {
+	t.Run("formatPatch", func(t *testing.T) {
+		dir := t.TempDir()
+		writeFiles(t, dir,
+			"0010-tenth.patch",
+			"0002-second.patch",
+			"0000-cover-letter.patch",
+			"notes.txt",
+			".0001-hidden.patch",
+			"extra.diff",
+		)
+
+		files, err := expandPatchFiles([]string{"-", dir})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		expected := []string{
+			"-",
+			filepath.Join(dir, "0000-cover-letter.patch"),
+			filepath.Join(dir, "0002-second.patch"),
+			filepath.Join(dir, "0010-tenth.patch"),
+			filepath.Join(dir, "extra.diff"),
+		}
+		if !reflect.DeepEqual(expected, files) {
+			t.Errorf("incorrect files:\nexpected: %q\n  actual: %q", expected, files)
+		}
+	})
+
+	t.Run("maildir", func(t *testing.T) {
+		dir := t.TempDir()
+		writeFiles(t, dir,
+			"cur/1700000200.M2P2.host:2,S",
+			"new/1700000100.M1P1.host",
+			"new/1700000300.M3P3.host",
+			"tmp/1700000050.M0P0.host",
+		)
+
+		files, err := expandPatchFiles([]string{dir})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		expected := []string{
+			filepath.Join(dir, "new/1700000100.M1P1.host"),
+			filepath.Join(dir, "cur/1700000200.M2P2.host:2,S"),
+			filepath.Join(dir, "new/1700000300.M3P3.host"),
+		}
+		if !reflect.DeepEqual(expected, files) {
+			t.Errorf("incorrect files:\nexpected: %q\n  actual: %q", expected, files)
+		}
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		if _, err := expandPatchFiles([]string{t.TempDir()}); err == nil {
+			t.Fatal("expected error for empty directory, but got nil")
+		}
+	})
+}
+
+func writeFiles(t *testing.T, dir string, names ...string) {
+	for _, name := range names {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("error creating directory: %v", err)
+		}
+		if err := os.WriteFile(path, nil, 0o644); err != nil {
+			t.Fatalf("error writing file: %v", err)
+		}
+	}
+}
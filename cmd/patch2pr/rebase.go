@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/bluekeyes/patch2pr"
+	"github.com/google/go-github/v89/github"
+)
+
+// refUpdater updates a branch. It is implemented by *patch2pr.Reference.
+type refUpdater interface {
+	Set(ctx context.Context, sha string, force bool) error
+	CompareAndSet(ctx context.Context, sha, expected string, force bool) error
+}
+
+// headUpdate updates the head branch to point to new commits.
+type headUpdate struct {
+	ref     refUpdater
+	branch  string
+	force   bool
+	retries int
+
+	// isAncestor returns true if the commit tip is an ancestor of sha, so that
+	// updating the branch from tip to sha is a fast-forward.
+	isAncestor func(ctx context.Context, tip, sha string) (bool, error)
+
+	// rebase applies the patches again on top of the commit tip and returns
+	// the new commits.
+	rebase func(ctx context.Context, tip string) ([]*github.Commit, error)
+}
+
+// run points the head branch at the last of commits. Unless force is set, it
+// only updates the branch if it points to expectedHead, or if expectedHead is
+// empty, if the branch does not exist or the update is a fast-forward. If the
+// branch points to a different commit, like when it moved while applying the
+// patches, run rebases the commits on the branch and tries again, up to
+// retries times. Other errors are not retried.
+//
+// It returns the commits on the branch and the number of rebases.
+func (u *headUpdate) run(ctx context.Context, commits []*github.Commit, expectedHead string) ([]*github.Commit, int, error) {
+	if u.force {
+		if err := u.ref.Set(ctx, commits[len(commits)-1].GetSHA(), true); err != nil {
+			return nil, 0, fmt.Errorf("set ref failed: %w", err)
+		}
+		return commits, 0, nil
+	}
+
+	var rebases int
+	for {
+		sha := commits[len(commits)-1].GetSHA()
+
+		err := u.ref.CompareAndSet(ctx, sha, expectedHead, false)
+		if err == nil {
+			return commits, rebases, nil
+		}
+
+		mismatch := refMismatch(err)
+		if mismatch == nil || mismatch.Actual == "" {
+			return nil, rebases, fmt.Errorf("set ref failed: %w", err)
+		}
+		tip := mismatch.Actual
+
+		if expectedHead == "" {
+			ff, err := u.isAncestor(ctx, tip, sha)
+			if err != nil {
+				return nil, rebases, err
+			}
+			if ff {
+				expectedHead = tip
+				continue
+			}
+		}
+
+		if rebases >= u.retries {
+			if expectedHead == "" {
+				return nil, rebases, fmt.Errorf("head branch %q exists and updating it is not a fast-forward", u.branch)
+			}
+			return nil, rebases, fmt.Errorf("set ref failed: %w", err)
+		}
+
+		rebases++
+		expectedHead = tip
+		fmt.Fprintf(os.Stderr, "warning: head branch %q is not a fast-forward, rebasing on %s (attempt %d/%d)\n", u.branch, tip, rebases, u.retries)
+
+		if commits, err = u.rebase(ctx, tip); err != nil {
+			return nil, rebases, err
+		}
+	}
+}
+
+// refMismatch returns the *patch2pr.RefMismatchError in err's chain or nil.
+func refMismatch(err error) *patch2pr.RefMismatchError {
+	var merr *patch2pr.RefMismatchError
+	if errors.As(err, &merr) {
+		return merr
+	}
+	return nil
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/bluekeyes/patch2pr"
+	"github.com/google/go-github/v89/github"
+)
+
+func TestHeadUpdate(t *testing.T) {
+	const (
+		base    = "base"
+		moved   = "moved"
+		applied = "applied"
+		rebased = "rebased"
+	)
+
+	unprocessable := &github.ErrorResponse{
+		Response: &http.Response{StatusCode: http.StatusUnprocessableEntity},
+		Message:  "Reference update failed",
+	}
+
+	tests := map[string]struct {
+		Expected string
+		Errors   []error
+		Ancestor bool
+		Retries  int
+
+		Calls   []string
+		Commit  string
+		Rebases int
+		Error   bool
+	}{
+		"create": {
+			Calls:  []string{"applied:"},
+			Commit: applied,
+		},
+		"rebaseOnce": {
+			Expected: base,
+			Errors:   []error{&patch2pr.RefMismatchError{Expected: base, Actual: moved}},
+			Retries:  2,
+			Calls:    []string{"applied:base", "rebased:moved"},
+			Commit:   rebased,
+			Rebases:  1,
+		},
+		"rebaseExisting": {
+			Errors:  []error{&patch2pr.RefMismatchError{Actual: moved}},
+			Retries: 1,
+			Calls:   []string{"applied:", "rebased:moved"},
+			Commit:  rebased,
+			Rebases: 1,
+		},
+		"fastForward": {
+			Errors:   []error{&patch2pr.RefMismatchError{Actual: base}},
+			Ancestor: true,
+			Calls:    []string{"applied:", "applied:base"},
+			Commit:   applied,
+		},
+		"noRetries": {
+			Expected: base,
+			Errors:   []error{&patch2pr.RefMismatchError{Expected: base, Actual: moved}},
+			Calls:    []string{"applied:base"},
+			Error:    true,
+		},
+		"retriesExhausted": {
+			Expected: base,
+			Errors: []error{
+				&patch2pr.RefMismatchError{Expected: base, Actual: moved},
+				&patch2pr.RefMismatchError{Expected: moved, Actual: "again"},
+			},
+			Retries: 1,
+			Calls:   []string{"applied:base", "rebased:moved"},
+			Rebases: 1,
+			Error:   true,
+		},
+		"otherError": {
+			Expected: base,
+			Errors:   []error{unprocessable},
+			Retries:  2,
+			Calls:    []string{"applied:base"},
+			Error:    true,
+		},
+		"deleted": {
+			Expected: base,
+			Errors:   []error{&patch2pr.RefMismatchError{Expected: base}},
+			Retries:  2,
+			Calls:    []string{"applied:base"},
+			Error:    true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			ref := &fakeRefUpdater{errors: test.Errors}
+			update := &headUpdate{
+				ref:     ref,
+				branch:  "patch2pr",
+				retries: test.Retries,
+				isAncestor: func(ctx context.Context, tip, sha string) (bool, error) {
+					return test.Ancestor, nil
+				},
+				rebase: func(ctx context.Context, tip string) ([]*github.Commit, error) {
+					return []*github.Commit{{SHA: github.Ptr(rebased)}}, nil
+				},
+			}
+
+			commits, rebases, err := update.run(context.Background(), []*github.Commit{{SHA: github.Ptr(applied)}}, test.Expected)
+			if test.Error {
+				if err == nil {
+					t.Fatal("expected error, but got nil")
+				}
+			} else {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if sha := commits[len(commits)-1].GetSHA(); sha != test.Commit {
+					t.Errorf("incorrect commit: expected %q, actual %q", test.Commit, sha)
+				}
+			}
+
+			if rebases != test.Rebases {
+				t.Errorf("incorrect rebases: expected %d, actual %d", test.Rebases, rebases)
+			}
+			if len(ref.calls) != len(test.Calls) {
+				t.Fatalf("incorrect updates: expected %v, actual %v", test.Calls, ref.calls)
+			}
+			for i := range test.Calls {
+				if ref.calls[i] != test.Calls[i] {
+					t.Errorf("incorrect update %d: expected %q, actual %q", i, test.Calls[i], ref.calls[i])
+				}
+			}
+		})
+	}
+}
+
+func TestHeadUpdateForce(t *testing.T) {
+	ref := &fakeRefUpdater{}
+	update := &headUpdate{ref: ref, force: true, retries: 2}
+
+	_, rebases, err := update.run(context.Background(), []*github.Commit{{SHA: github.Ptr("applied")}}, "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if rebases != 0 {
+		t.Errorf("incorrect rebases: expected 0, actual %d", rebases)
+	}
+	if len(ref.calls) != 1 || ref.calls[0] != "force:applied" {
+		t.Errorf("incorrect updates: expected [force:applied], actual %v", ref.calls)
+	}
+}
+
+// fakeRefUpdater records updates as "sha:expected" and returns errors in
+// order until there are none left.
+type fakeRefUpdater struct {
+	errors []error
+	calls  []string
+}
+
+func (f *fakeRefUpdater) Set(ctx context.Context, sha string, force bool) error {
+	if !force {
+		return errors.New("unexpected update without force")
+	}
+	f.calls = append(f.calls, "force:"+sha)
+	return f.next()
+}
+
+func (f *fakeRefUpdater) CompareAndSet(ctx context.Context, sha, expected string, force bool) error {
+	f.calls = append(f.calls, sha+":"+expected)
+	return f.next()
+}
+
+func (f *fakeRefUpdater) next() error {
+	if len(f.errors) == 0 {
+		return nil
+	}
+	err := f.errors[0]
+	f.errors = f.errors[1:]
+	return err
+}
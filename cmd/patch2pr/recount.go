@@ -0,0 +1,233 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// hunkHeader is a parsed hunk header like "@@ -1,5 +1,6 @@ func main() {".
+type hunkHeader struct {
+	oldStart, oldLines int
+	newStart, newLines int
+
+	// section is the text after the closing "@@", including the line ending
+	section string
+}
+
+// parseHunkHeader parses a hunk header. A range without a count, like "-1",
+// has one line.
+func parseHunkHeader(line string) (hunkHeader, bool) {
+	rest, ok := strings.CutPrefix(line, "@@ -")
+	if !ok {
+		return hunkHeader{}, false
+	}
+	ranges, section, ok := strings.Cut(rest, " @@")
+	if !ok {
+		return hunkHeader{}, false
+	}
+	oldRange, newRange, ok := strings.Cut(ranges, " +")
+	if !ok {
+		return hunkHeader{}, false
+	}
+
+	h := hunkHeader{section: section}
+
+	var oldOK, newOK bool
+	h.oldStart, h.oldLines, oldOK = parseHunkRange(oldRange)
+	h.newStart, h.newLines, newOK = parseHunkRange(newRange)
+	if !oldOK || !newOK {
+		return hunkHeader{}, false
+	}
+	return h, true
+}
+
+func parseHunkRange(r string) (start, count int, ok bool) {
+	s, c, hasCount := strings.Cut(r, ",")
+
+	start, err := strconv.Atoi(s)
+	if err != nil || start < 0 {
+		return 0, 0, false
+	}
+	if !hasCount {
+		return start, 1, true
+	}
+
+	count, err = strconv.Atoi(c)
+	if err != nil || count < 0 {
+		return 0, 0, false
+	}
+	return start, count, true
+}
+
+func (h hunkHeader) String() string {
+	return fmt.Sprintf("@@ -%d,%d +%d,%d @@%s", h.oldStart, h.oldLines, h.newStart, h.newLines, h.section)
+}
+
+// recountedHunk describes a hunk header with line counts that did not match
+// the hunk.
+type recountedHunk struct {
+	file     string
+	original string
+	fixed    string
+}
+
+// recountHunks replaces the line counts in each hunk header in content with
+// the number of lines in the hunk, like 'git apply --recount'. It returns the
+// new content and the hunks with changed headers.
+//
+// A hunk ends at the next hunk or file header, at the signature that 'git
+// format-patch' adds after the diff, or at a line that cannot be part of a
+// hunk. Empty lines are context lines unless they are at the end of the hunk
+// and not followed by another hunk.
+func recountHunks(content []byte) ([]byte, []recountedHunk) {
+	lines := strings.SplitAfter(string(content), "\n")
+
+	var file string
+	var recounted []recountedHunk
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		if name, ok := cutFileHeader(line); ok {
+			// Prefer the new name unless the file was deleted
+			if name != "/dev/null" || file == "" {
+				file = name
+			}
+			continue
+		}
+		if strings.HasPrefix(line, "diff ") {
+			file = ""
+			continue
+		}
+
+		h, ok := parseHunkHeader(line)
+		if !ok || file == "" {
+			continue
+		}
+
+		n, oldLines, newLines := countHunk(lines[i+1:])
+		if oldLines != h.oldLines || newLines != h.newLines {
+			original := strings.TrimRight(line, "\r\n")
+			h.oldLines, h.newLines = oldLines, newLines
+			lines[i] = h.String()
+			recounted = append(recounted, recountedHunk{
+				file:     file,
+				original: original,
+				fixed:    strings.TrimRight(lines[i], "\r\n"),
+			})
+		}
+		i += n
+	}
+
+	if len(recounted) == 0 {
+		return content, nil
+	}
+	return []byte(strings.Join(lines, "")), recounted
+}
+
+// countHunk returns the number of lines in the hunk body at the start of
+// lines and the number of old and new lines in the body.
+func countHunk(lines []string) (n, oldLines, newLines int) {
+	var trailingEmpty int
+	for ; n < len(lines); n++ {
+		line := lines[n]
+		if line == "" {
+			break
+		}
+
+		if line == "\n" || line == "\r\n" {
+			trailingEmpty++
+		} else {
+			trailingEmpty = 0
+		}
+
+		switch line[0] {
+		case ' ', '\n', '\r':
+			oldLines++
+			newLines++
+			continue
+		case '+':
+			newLines++
+			continue
+		case '\\':
+			continue
+		case '-':
+			if !isFileHeader(lines[n:]) && !isSignature(lines[n:]) {
+				oldLines++
+				continue
+			}
+		}
+		break
+	}
+
+	if trailingEmpty > 0 && (n == len(lines) || !strings.HasPrefix(lines[n], "@@ ")) {
+		n -= trailingEmpty
+		oldLines -= trailingEmpty
+		newLines -= trailingEmpty
+	}
+	return n, oldLines, newLines
+}
+
+// isFileHeader returns true if lines start with the file header of a
+// unified diff.
+func isFileHeader(lines []string) bool {
+	return len(lines) > 2 &&
+		strings.HasPrefix(lines[0], "--- ") &&
+		strings.HasPrefix(lines[1], "+++ ") &&
+		strings.HasPrefix(lines[2], "@@ ")
+}
+
+// isSignature returns true if lines start with the signature separator that
+// 'git format-patch' adds after the diff, followed by text that cannot be
+// part of a hunk.
+func isSignature(lines []string) bool {
+	if strings.TrimRight(lines[0], "\r\n") != "-- " {
+		return false
+	}
+	if len(lines) == 1 || lines[1] == "" {
+		return false
+	}
+	switch lines[1][0] {
+	case ' ', '-', '+', '\\', '\n', '\r', '@':
+		return false
+	}
+	return !strings.HasPrefix(lines[1], "diff ")
+}
+
+// cutFileHeader returns the file name from a "--- " or "+++ " file header
+// line.
+func cutFileHeader(line string) (string, bool) {
+	rest, ok := strings.CutPrefix(line, "--- ")
+	if !ok {
+		if rest, ok = strings.CutPrefix(line, "+++ "); !ok {
+			return "", false
+		}
+	}
+	rest = strings.TrimRight(rest, "\r\n")
+	name, _, _ := strings.Cut(rest, "\t")
+	return name, true
+}
+
+// recountFS is a file system that recounts the hunks of the files it reads.
+type recountFS struct {
+	fs.FS
+}
+
+func (fsys recountFS) ReadFile(name string) ([]byte, error) {
+	content, err := fs.ReadFile(fsys.FS, name)
+	if err != nil {
+		return nil, err
+	}
+	return recount(name, content), nil
+}
+
+// recount recounts the hunks in content and prints a warning for each hunk
+// with a changed header.
+func recount(patchFile string, content []byte) []byte {
+	content, recounted := recountHunks(content)
+	for _, h := range recounted {
+		fmt.Fprintf(os.Stderr, "warning: %s: fixed line counts for %s: %q is now %q\n", patchFile, h.file, h.original, h.fixed)
+	}
+	return content
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/bluekeyes/go-gitdiff/gitdiff"
+)
+
+func TestParseHunkHeader(t *testing.T) {
+	tests := []struct {
+		Line     string
+		OldLines int
+		NewLines int
+		OK       bool
+	}{
+		{Line: "@@ -1,3 +1,4 @@", OldLines: 3, NewLines: 4, OK: true},
+		{Line: "@@ -1 +1 @@ func main() {", OldLines: 1, NewLines: 1, OK: true},
+		{Line: "@@ -0,0 +1,2 @@", OldLines: 0, NewLines: 2, OK: true},
+		{Line: "@@ -1,x +1 @@"},
+		{Line: "@@ -1,3 +1,4"},
+		{Line: "@@@ -1 -1 +1 @@@"},
+	}
+
+	for _, test := range tests {
+		h, ok := parseHunkHeader(test.Line)
+		if ok != test.OK || h.oldLines != test.OldLines || h.newLines != test.NewLines {
+			t.Errorf("%q: expected (%d, %d, %t), actual (%d, %d, %t)", test.Line, test.OldLines, test.NewLines, test.OK, h.oldLines, h.newLines, ok)
+		}
+	}
+}
+
+func TestRecountHunks(t *testing.T) {
+	tests := map[string]struct {
+		Input     string
+		Output    string
+		Recounted []recountedHunk
+	}{
+		"correctCounts": {
+			Input: lines(
+				"--- a/hello.txt",
+				"+++ b/hello.txt",
+				"@@ -1,2 +1,2 @@",
+				"-hello",
+				"+hello, world",
+				" goodbye",
+			),
+		},
+		"gitFormatPatch": {
+			Input: lines(
+				"Subject: [PATCH] Fix the greeting",
+				"",
+				"---",
+				"diff --git a/hello.txt b/hello.txt",
+				"--- a/hello.txt",
+				"+++ b/hello.txt",
+				"@@ -1,2 +1,2 @@ greeting",
+				"-hello",
+				"+hello, world",
+				"+!",
+				" goodbye",
+				"diff --git a/old.txt b/old.txt",
+				"deleted file mode 100644",
+				"--- a/old.txt",
+				"+++ /dev/null",
+				"@@ -1,3 +0,0 @@",
+				"-old",
+				"-- ",
+				"2.43.0",
+				"",
+			),
+			Output: lines(
+				"Subject: [PATCH] Fix the greeting",
+				"",
+				"---",
+				"diff --git a/hello.txt b/hello.txt",
+				"--- a/hello.txt",
+				"+++ b/hello.txt",
+				"@@ -1,2 +1,3 @@ greeting",
+				"-hello",
+				"+hello, world",
+				"+!",
+				" goodbye",
+				"diff --git a/old.txt b/old.txt",
+				"deleted file mode 100644",
+				"--- a/old.txt",
+				"+++ /dev/null",
+				"@@ -1,1 +0,0 @@",
+				"-old",
+				"-- ",
+				"2.43.0",
+				"",
+			),
+			Recounted: []recountedHunk{
+				{file: "b/hello.txt", original: "@@ -1,2 +1,2 @@ greeting", fixed: "@@ -1,2 +1,3 @@ greeting"},
+				{file: "a/old.txt", original: "@@ -1,3 +0,0 @@", fixed: "@@ -1,1 +0,0 @@"},
+			},
+		},
+		"traditionalDiff": {
+			Input: lines(
+				"--- project.orig/a.txt\t2024-01-01 00:00:00",
+				"+++ project/a.txt\t2024-01-01 00:00:00",
+				"@@ -1 +1 @@",
+				"-a",
+				"",
+				"+b",
+				"@@ -10 +10 @@",
+				"-x",
+				"+y",
+				"--- project.orig/b.txt",
+				"+++ project/b.txt",
+				"@@ -5,4 +5,4 @@",
+				" b",
+				"+c",
+				"",
+				"",
+			),
+			Output: lines(
+				"--- project.orig/a.txt\t2024-01-01 00:00:00",
+				"+++ project/a.txt\t2024-01-01 00:00:00",
+				"@@ -1,2 +1,2 @@",
+				"-a",
+				"",
+				"+b",
+				"@@ -10 +10 @@",
+				"-x",
+				"+y",
+				"--- project.orig/b.txt",
+				"+++ project/b.txt",
+				"@@ -5,1 +5,2 @@",
+				" b",
+				"+c",
+				"",
+				"",
+			),
+			Recounted: []recountedHunk{
+				{file: "project/a.txt", original: "@@ -1 +1 @@", fixed: "@@ -1,2 +1,2 @@"},
+				{file: "project/b.txt", original: "@@ -5,4 +5,4 @@", fixed: "@@ -5,1 +5,2 @@"},
+			},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			output, recounted := recountHunks([]byte(test.Input))
+
+			expected := test.Output
+			if expected == "" {
+				expected = test.Input
+			}
+			if string(output) != expected {
+				t.Errorf("incorrect output\nexpected:\n%s\nactual:\n%s", expected, output)
+			}
+
+			if len(recounted) != len(test.Recounted) {
+				t.Fatalf("incorrect number of recounted hunks: expected %d, actual %d: %+v", len(test.Recounted), len(recounted), recounted)
+			}
+			for i := range recounted {
+				if recounted[i] != test.Recounted[i] {
+					t.Errorf("incorrect recounted hunk %d: expected %+v, actual %+v", i, test.Recounted[i], recounted[i])
+				}
+			}
+
+			if _, _, err := gitdiff.Parse(bytes.NewReader(output)); err != nil {
+				t.Errorf("unexpected error parsing output: %v", err)
+			}
+		})
+	}
+}
+
+func lines(s ...string) string {
+	return strings.Join(s, "\n") + "\n"
+}
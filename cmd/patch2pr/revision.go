@@ -0,0 +1,359 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/bluekeyes/go-gitdiff/gitdiff"
+	"github.com/google/go-github/v89/github"
+
+	"github.com/bluekeyes/patch2pr"
+)
+
+type RevisionResult struct {
+	Version         int    `json:"version"`
+	PreviousCommits int    `json:"previous_commits"`
+	CommentURL      string `json:"comment_url,omitempty"`
+}
+
+// revision is a previous revision of a patch series that has an open pull
+// request on the head branch.
+type revision struct {
+	pr      *patch2pr.PullRequest
+	commits []rangeDiffCommit
+}
+
+// rangeDiffCommit is a commit prepared for comparison with a commit from a
+// different revision of the same series.
+type rangeDiffCommit struct {
+	sha   string
+	title string
+	lines []string
+}
+
+// maxRangeDiffCells limits the work done comparing two versions of a patch.
+// Pairs of patches with more lines than this are reported as changed without
+// showing the differences.
+const maxRangeDiffCells = 4 * 1024 * 1024
+
+// patchVersion returns the revision number from a subject prefix like
+// "[PATCH v3 2/5]". It returns 1 if the prefix has no revision number.
+func patchVersion(h *gitdiff.PatchHeader) int {
+	if h == nil {
+		return 1
+	}
+	return parseSubjectPrefix(h.SubjectPrefix).Version
+}
+
+// seriesVersion returns the highest revision number of any patch.
+func seriesVersion(patches []Patch) int {
+	version := 1
+	for _, p := range patches {
+		version = max(version, patchVersion(p.header))
+	}
+	return version
+}
+
+// findPreviousRevision returns the previous revision of a series if there is
+// an open pull request from the head branch to the base branch with the same
+// title. It returns nil if there is no previous revision.
+//
+// The series has no identifier that is stable across revisions, so this is a
+// heuristic: an unrelated pull request with the same branches and title is
+// treated as a previous revision, and its branch is force updated.
+func findPreviousRevision(ctx context.Context, client *github.Client, prs *patch2pr.GraphQLPullRequests, head, target patch2pr.Repository, base, branch, title string) (*revision, error) {
+	pr, err := prs.Find(ctx, head, branch)
+	if err != nil {
+		return nil, err
+	}
+	if !isPreviousRevision(pr, base, title) {
+		return nil, nil
+	}
+
+	rev := &revision{pr: pr}
+
+	opts := &github.ListOptions{PerPage: 100}
+	for {
+		commits, res, err := client.PullRequests.ListCommits(ctx, target.Owner, target.Name, pr.Number, opts)
+		if err != nil {
+			return nil, fmt.Errorf("list commits for pull request #%d failed: %w", pr.Number, err)
+		}
+		for _, c := range commits {
+			rdc, err := loadRangeDiffCommit(ctx, client, head, c.GetSHA(), c.GetCommit().GetMessage())
+			if err != nil {
+				return nil, err
+			}
+			rev.commits = append(rev.commits, rdc)
+		}
+		if res.NextPage == 0 {
+			break
+		}
+		opts.Page = res.NextPage
+	}
+	return rev, nil
+}
+
+// isPreviousRevision returns true if pr targets the base branch and has the
+// same title, ignoring case and surrounding space.
+func isPreviousRevision(pr *patch2pr.PullRequest, base, title string) bool {
+	if pr == nil || pr.BaseRefName != base {
+		return false
+	}
+	return strings.EqualFold(strings.TrimSpace(pr.Title), strings.TrimSpace(title))
+}
+
+func loadRangeDiffCommit(ctx context.Context, client *github.Client, repo patch2pr.Repository, sha, message string) (rangeDiffCommit, error) {
+	diff, _, err := client.Repositories.GetCommitRaw(ctx, repo.Owner, repo.Name, sha, github.RawOptions{Type: github.Diff})
+	if err != nil {
+		return rangeDiffCommit{}, fmt.Errorf("get diff for commit %s failed: %w", sha, err)
+	}
+	return newRangeDiffCommit(sha, message, diff), nil
+}
+
+func newRangeDiffCommit(sha, message, diff string) rangeDiffCommit {
+	title, _ := splitMessage(message)
+
+	lines := strings.Split(strings.TrimRight(message, "\n"), "\n")
+	lines = append(lines, "")
+	lines = append(lines, normalizeDiff(diff)...)
+
+	return rangeDiffCommit{sha: sha, title: title, lines: lines}
+}
+
+var hunkHeaderRegexp = regexp.MustCompile(`^@@ -\d+(?:,\d+)? \+\d+(?:,\d+)? @@`)
+
+// normalizeDiff removes the parts of a diff that change when a patch is
+// applied to a different base without changing its content: blob IDs and
+// hunk line numbers.
+func normalizeDiff(diff string) []string {
+	var lines []string
+	for _, line := range strings.Split(strings.TrimRight(diff, "\n"), "\n") {
+		if strings.HasPrefix(line, "index ") {
+			continue
+		}
+		lines = append(lines, hunkHeaderRegexp.ReplaceAllLiteralString(line, "@@"))
+	}
+	return lines
+}
+
+// formatRangeDiff compares two revisions of a series in the style of 'git
+// range-diff'. Commits are paired by title. Each pair is marked as unchanged
+// ('=') or changed ('!'), with the differences between the patches for
+// changed pairs. Commits only in the old revision are marked with '<' and
+// commits only in the new revision are marked with '>'.
+func formatRangeDiff(old, new []rangeDiffCommit) string {
+	pairs := make([]int, len(new))
+	used := make([]bool, len(old))
+	for j, n := range new {
+		pairs[j] = -1
+		for i, o := range old {
+			if !used[i] && o.title == n.title {
+				pairs[j] = i
+				used[i] = true
+				break
+			}
+		}
+	}
+
+	width := len(strconv.Itoa(max(len(old), len(new))))
+	commit := func(i int, c *rangeDiffCommit) string {
+		if c == nil {
+			return fmt.Sprintf("%*s:  %s", width, "-", strings.Repeat("-", 7))
+		}
+		return fmt.Sprintf("%*d:  %s", width, i+1, shortSHA(c.sha))
+	}
+
+	var b strings.Builder
+	removed := 0
+	writeRemoved := func(until int) {
+		for ; removed < until; removed++ {
+			if !used[removed] {
+				fmt.Fprintf(&b, "%s < %s %s\n", commit(removed, &old[removed]), commit(0, nil), old[removed].title)
+			}
+		}
+	}
+
+	for j := range new {
+		n := &new[j]
+		i := pairs[j]
+		if i < 0 {
+			fmt.Fprintf(&b, "%s > %s %s\n", commit(0, nil), commit(j, n), n.title)
+			continue
+		}
+
+		writeRemoved(i)
+		o := &old[i]
+
+		diff, ok := diffLines(o.lines, n.lines, 3)
+		if ok && len(diff) == 0 {
+			fmt.Fprintf(&b, "%s = %s %s\n", commit(i, o), commit(j, n), n.title)
+			continue
+		}
+
+		fmt.Fprintf(&b, "%s ! %s %s\n", commit(i, o), commit(j, n), n.title)
+		if !ok {
+			b.WriteString("    (patches are too large to compare)\n")
+		}
+		for _, line := range diff {
+			fmt.Fprintf(&b, "    %s\n", line)
+		}
+	}
+	writeRemoved(len(old))
+
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// diffLines returns the lines of a unified diff between a and b with the given
+// number of context lines. Hunks are separated by a line containing only "@@".
+// It returns false if the inputs are too large to compare.
+func diffLines(a, b []string, context int) ([]string, bool) {
+	// Trim the common prefix and suffix to reduce the size of the table
+	start := 0
+	for start < len(a) && start < len(b) && a[start] == b[start] {
+		start++
+	}
+	end := 0
+	for end < len(a)-start && end < len(b)-start && a[len(a)-1-end] == b[len(b)-1-end] {
+		end++
+	}
+	if start == len(a) && start == len(b) {
+		return nil, true
+	}
+
+	ma, mb := a[start:len(a)-end], b[start:len(b)-end]
+	if (len(ma)+1)*(len(mb)+1) > maxRangeDiffCells {
+		return nil, false
+	}
+
+	// lcs[i][j] is the length of the longest common subsequence of ma[i:] and mb[j:]
+	lcs := make([][]int, len(ma)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(mb)+1)
+	}
+	for i := len(ma) - 1; i >= 0; i-- {
+		for j := len(mb) - 1; j >= 0; j-- {
+			if ma[i] == mb[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var ops []string
+	for _, line := range a[:start] {
+		ops = append(ops, " "+line)
+	}
+	i, j := 0, 0
+	for i < len(ma) || j < len(mb) {
+		switch {
+		case i < len(ma) && j < len(mb) && ma[i] == mb[j]:
+			ops = append(ops, " "+ma[i])
+			i++
+			j++
+		case i < len(ma) && (j == len(mb) || lcs[i+1][j] >= lcs[i][j+1]):
+			ops = append(ops, "-"+ma[i])
+			i++
+		default:
+			ops = append(ops, "+"+mb[j])
+			j++
+		}
+	}
+	for _, line := range a[len(a)-end:] {
+		ops = append(ops, " "+line)
+	}
+
+	// Keep changed lines and the context around them
+	keep := make([]bool, len(ops))
+	for k, op := range ops {
+		if op[0] != ' ' {
+			for c := max(0, k-context); c <= min(len(ops)-1, k+context); c++ {
+				keep[c] = true
+			}
+		}
+	}
+
+	var out []string
+	for k, op := range ops {
+		if !keep[k] {
+			continue
+		}
+		if k == 0 || !keep[k-1] {
+			out = append(out, "@@")
+		}
+		out = append(out, op)
+	}
+	return out, true
+}
+
+// maxCommentLength is the maximum length of an issue comment on GitHub.
+const maxCommentLength = 65536
+
+const rangeDiffTruncated = "\n\nThe range diff is truncated because it is too long for a comment."
+
+// revisionComment returns the comment for a new revision of a series. It
+// truncates the range diff at a line boundary if the comment would be longer
+// than maxCommentLength.
+func revisionComment(version int, rangeDiff string) string {
+	intro := fmt.Sprintf("Updated to v%d of the patch series.\n\nRange diff against the previous revision:\n\n", version)
+	fence := codeFence(rangeDiff)
+
+	var note string
+	limit := maxCommentLength - len(intro) - 2*len(fence) - len("diff\n\n")
+	if len(rangeDiff) > limit {
+		limit -= len(rangeDiffTruncated)
+		rangeDiff = rangeDiff[:limit]
+		if i := strings.LastIndexByte(rangeDiff, '\n'); i >= 0 {
+			rangeDiff = rangeDiff[:i]
+		}
+		rangeDiff = strings.ToValidUTF8(rangeDiff, "")
+		note = rangeDiffTruncated
+	}
+	return fmt.Sprintf("%s%sdiff\n%s\n%s%s", intro, fence, rangeDiff, fence, note)
+}
+
+// codeFence returns a Markdown code fence that is longer than any sequence of
+// backticks in s.
+func codeFence(s string) string {
+	longest, run := 0, 0
+	for i := 0; i < len(s); i++ {
+		if s[i] == '`' {
+			run++
+			longest = max(longest, run)
+		} else {
+			run = 0
+		}
+	}
+	return strings.Repeat("`", max(3, longest+1))
+}
+
+func shortSHA(sha string) string {
+	if len(sha) > 7 {
+		return sha[:7]
+	}
+	return sha
+}
+
+// commentRangeDiff compares the commits of a previous revision with the new
+// commits and posts the result as a comment on the pull request.
+func commentRangeDiff(ctx context.Context, client *github.Client, head, target patch2pr.Repository, pr *patch2pr.PullRequest, prev *revision, newCommits []*github.Commit, res *RevisionResult) error {
+	commits := make([]rangeDiffCommit, len(newCommits))
+	for i, c := range newCommits {
+		rdc, err := loadRangeDiffCommit(ctx, client, head, c.GetSHA(), c.GetMessage())
+		if err != nil {
+			return fmt.Errorf("range diff failed: %w", err)
+		}
+		commits[i] = rdc
+	}
+
+	body := revisionComment(res.Version, formatRangeDiff(prev.commits, commits))
+	comment, _, err := client.Issues.CreateComment(ctx, target.Owner, target.Name, pr.Number, &github.IssueComment{Body: &body})
+	if err != nil {
+		return fmt.Errorf("create range diff comment failed: %w", err)
+	}
+	res.CommentURL = comment.GetHTMLURL()
+	return nil
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/bluekeyes/go-gitdiff/gitdiff"
+
+	"github.com/bluekeyes/patch2pr"
+)
+
+func TestPatchVersion(t *testing.T) {
+	tests := map[string]int{
+		"":                  1,
+		"[PATCH] ":          1,
+		"[PATCH 2/3] ":      1,
+		"[PATCH v2] ":       2,
+		"[PATCH v3 1/4] ":   3,
+		"[RFC][PATCH V10] ": 10,
+		"[PATCH vfoo 1/2] ": 1,
+	}
+
+	for prefix, expected := range tests {
+		if got := patchVersion(&gitdiff.PatchHeader{SubjectPrefix: prefix}); got != expected {
+			t.Errorf("incorrect version for %q: expected %d, got %d", prefix, expected, got)
+		}
+	}
+
+	if got := patchVersion(nil); got != 1 {
+		t.Errorf("incorrect version for nil header: expected 1, got %d", got)
+	}
+}
+
+func TestNormalizeDiff(t *testing.T) {
+	diff := `diff --git a/file.txt b/file.txt
+index 1234567..89abcde 100644
+--- a/file.txt
++++ b/file.txt
+@@ -10,3 +10,4 @@ func main() {
+ a
++b
+ c
+`
+	expected := []string{
+		"diff --git a/file.txt b/file.txt",
+		"--- a/file.txt",
+		"+++ b/file.txt",
+		"@@ func main() {",
+		" a",
+		"+b",
+		" c",
+	}
+
+	if got := normalizeDiff(diff); !reflect.DeepEqual(expected, got) {
+		t.Errorf("incorrect normalized diff:\nexpected: %q\n  actual: %q", expected, got)
+	}
+}
+
+func TestDiffLines(t *testing.T) {
+	a := []string{"1", "2", "3", "4", "5", "6", "7", "8", "9", "10"}
+	b := []string{"1", "2", "3", "4", "5", "six", "7", "8", "9", "10", "11"}
+
+	expected := []string{
+		"@@",
+		" 3",
+		" 4",
+		" 5",
+		"-6",
+		"+six",
+		" 7",
+		" 8",
+		" 9",
+		" 10",
+		"+11",
+	}
+
+	got, ok := diffLines(a, b, 3)
+	if !ok {
+		t.Fatal("expected diff to succeed")
+	}
+	if !reflect.DeepEqual(expected, got) {
+		t.Errorf("incorrect diff:\nexpected: %q\n  actual: %q", expected, got)
+	}
+
+	if got, ok := diffLines(a, a, 3); !ok || len(got) != 0 {
+		t.Errorf("expected empty diff for identical input, got %q", got)
+	}
+}
+
+func TestFormatRangeDiff(t *testing.T) {
+	old := []rangeDiffCommit{
+		newRangeDiffCommit("1111111aaaa", "Add parser", "@@ -1,1 +1,2 @@\n a\n+b\n"),
+		newRangeDiffCommit("2222222bbbb", "Fix typo", "@@ -5,1 +5,1 @@\n-teh\n+the\n"),
+		newRangeDiffCommit("3333333cccc", "Update docs", "@@ -1 +1 @@\n-x\n+y\n"),
+	}
+	new := []rangeDiffCommit{
+		newRangeDiffCommit("4444444dddd", "Add parser", "@@ -3,1 +3,2 @@\n a\n+b\n"),
+		newRangeDiffCommit("5555555eeee", "Update docs", "@@ -1 +1 @@\n-x\n+z\n"),
+		newRangeDiffCommit("6666666ffff", "Add tests", "@@ -0,0 +1 @@\n+test\n"),
+	}
+
+	expected := "1:  1111111 = 1:  4444444 Add parser\n" +
+		"2:  2222222 < -:  ------- Fix typo\n" +
+		"3:  3333333 ! 2:  5555555 Update docs\n" +
+		"    @@\n" +
+		"     \n" +
+		"     @@\n" +
+		"     -x\n" +
+		"    -+y\n" +
+		"    ++z\n" +
+		"-:  ------- > 3:  6666666 Add tests"
+
+	if got := formatRangeDiff(old, new); got != expected {
+		t.Errorf("incorrect range diff:\nexpected:\n%s\n\nactual:\n%s", expected, got)
+	}
+}
+
+func TestRevisionComment(t *testing.T) {
+	t.Run("fence", func(t *testing.T) {
+		comment := revisionComment(2, "1:  1111111 ! 1:  2222222 Add docs\n    +```go\n    +````")
+		if !strings.Contains(comment, "\n`````diff\n") || !strings.HasSuffix(comment, "\n`````") {
+			t.Errorf("incorrect code fence in comment:\n%s", comment)
+		}
+	})
+
+	t.Run("truncated", func(t *testing.T) {
+		line := "    +" + strings.Repeat("x", 95) + "\n"
+		rangeDiff := strings.Repeat(line, 2*maxCommentLength/len(line))
+
+		comment := revisionComment(2, rangeDiff)
+		if len(comment) > maxCommentLength {
+			t.Errorf("comment is too long: %d > %d", len(comment), maxCommentLength)
+		}
+		if !strings.HasSuffix(comment, "x\n```"+rangeDiffTruncated) {
+			t.Errorf("incorrect end of truncated comment: %q", comment[len(comment)-200:])
+		}
+	})
+}
+
+func TestIsPreviousRevision(t *testing.T) {
+	pr := &patch2pr.PullRequest{Title: "Add parser", BaseRefName: "main"}
+
+	tests := map[string]struct {
+		PR    *patch2pr.PullRequest
+		Base  string
+		Title string
+		Want  bool
+	}{
+		"match":      {PR: pr, Base: "main", Title: " add PARSER ", Want: true},
+		"noPR":       {PR: nil, Base: "main", Title: "Add parser"},
+		"otherBase":  {PR: pr, Base: "release", Title: "Add parser"},
+		"otherTitle": {PR: pr, Base: "main", Title: "Add lexer"},
+		"emptyTitle": {PR: pr, Base: "main", Title: ""},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := isPreviousRevision(test.PR, test.Base, test.Title); got != test.Want {
+				t.Errorf("incorrect result: expected %t, actual %t", test.Want, got)
+			}
+		})
+	}
+}
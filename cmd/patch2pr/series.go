@@ -0,0 +1,206 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/bluekeyes/go-gitdiff/gitdiff"
+)
+
+// seriesPosition is the position of a patch in a series as given by a subject
+// prefix like "[PATCH v2 3/5]". Number and Total are zero if the prefix does
+// not include a position.
+type seriesPosition struct {
+	Version int
+	Number  int
+	Total   int
+}
+
+// parseSubjectPrefix parses the revision and position of a patch from a
+// subject prefix. The version is 1 if the prefix has no revision number.
+func parseSubjectPrefix(prefix string) seriesPosition {
+	pos := seriesPosition{Version: 1}
+
+	fields := strings.FieldsFunc(prefix, func(r rune) bool {
+		return r == '[' || r == ']' || r == ' ' || r == '\t'
+	})
+	for _, f := range fields {
+		if len(f) > 1 && (f[0] == 'v' || f[0] == 'V') {
+			if n, err := strconv.Atoi(f[1:]); err == nil && n > 0 {
+				pos.Version = n
+			}
+			continue
+		}
+		if num, total, ok := strings.Cut(f, "/"); ok {
+			n, nerr := strconv.Atoi(num)
+			t, terr := strconv.Atoi(total)
+			if nerr == nil && terr == nil && n >= 0 && t > 0 {
+				pos.Number, pos.Total = n, t
+			}
+		}
+	}
+	return pos
+}
+
+// isCoverLetter returns true if the patch is the cover letter of a series: a
+// message numbered zero, like "[PATCH 0/3]", that does not change any files.
+func isCoverLetter(p Patch) bool {
+	if len(p.files) > 0 || p.header == nil {
+		return false
+	}
+	pos := parseSubjectPrefix(p.header.SubjectPrefix)
+	return pos.Total > 0 && pos.Number == 0
+}
+
+// splitCoverLetter removes the cover letter from patches, returning its
+// header and the remaining patches. The header is nil if there is no cover
+// letter.
+func splitCoverLetter(patches []Patch) (*gitdiff.PatchHeader, []Patch, error) {
+	var cover *gitdiff.PatchHeader
+	var rest []Patch
+	for _, p := range patches {
+		if !isCoverLetter(p) {
+			rest = append(rest, p)
+			continue
+		}
+		if cover != nil {
+			return nil, nil, errors.New("found multiple cover letters")
+		}
+		cover = p.header
+	}
+	return cover, rest, nil
+}
+
+var (
+	// The shortlog that 'git format-patch --cover-letter' adds after the body
+	shortlogRegexp = regexp.MustCompile(`^\S.* \(\d+\):$`)
+)
+
+const (
+	coverSubjectPlaceholder = "*** SUBJECT HERE ***"
+	coverBlurbPlaceholder   = "*** BLURB HERE ***"
+)
+
+// coverLetterText returns the title and body for a pull request from a cover
+// letter. It removes the placeholders, shortlog, diffstat, and signature
+// added by 'git format-patch --cover-letter'.
+func coverLetterText(h *gitdiff.PatchHeader) (title string, body string) {
+	title = strings.TrimSpace(h.Title)
+	if title == coverSubjectPlaceholder {
+		title = ""
+	}
+
+	var lines []string
+	for _, line := range strings.Split(h.Body, "\n") {
+		if shortlogRegexp.MatchString(line) || line == "--" || line == "-- " {
+			break
+		}
+		if strings.TrimSpace(line) == coverBlurbPlaceholder {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return title, strings.TrimSpace(strings.Join(lines, "\n"))
+}
+
+var (
+	// Bracketed prefixes like "[PATCH v2 1/3]" at the start of a title
+	titlePrefixRegexp = regexp.MustCompile(`^(?:\s*\[[^\]]*\])+\s*`)
+)
+
+// stripTitlePrefix moves a patch prefix like "[PATCH v2 1/3]" from the title
+// to the subject prefix. Email headers are already split this way, but other
+// header formats keep the prefix in the title. Prefixes that do not contain
+// "PATCH" are part of the title and are not removed.
+func stripTitlePrefix(h *gitdiff.PatchHeader) {
+	if h == nil || h.SubjectPrefix != "" {
+		return
+	}
+	prefix := titlePrefixRegexp.FindString(h.Title)
+	if prefix == "" || !strings.Contains(prefix, "PATCH") {
+		return
+	}
+	h.SubjectPrefix = prefix
+	h.Title = h.Title[len(prefix):]
+}
+
+// orderSeries sorts patches by their position in a series, like "[PATCH
+// 2/5]", and checks that the series is complete. Patches without positions
+// are returned unchanged. If partial is true, patches may be missing from the
+// series, but the patches that are present are still sorted.
+func orderSeries(patches []Patch, partial bool) ([]Patch, error) {
+	var positioned int
+	versions := make(map[int]bool)
+	for _, p := range patches {
+		if pos := patchPosition(p); pos.Total > 0 {
+			positioned++
+			versions[pos.Version] = true
+		}
+	}
+	if positioned == 0 {
+		return patches, nil
+	}
+
+	if positioned < len(patches) {
+		for _, p := range patches {
+			if patchPosition(p).Total == 0 {
+				return nil, fmt.Errorf("patch %s has no series number, but other patches do", describePatch(p))
+			}
+		}
+	}
+	if len(versions) > 1 {
+		var vs []string
+		for v := range versions {
+			vs = append(vs, fmt.Sprintf("v%d", v))
+		}
+		slices.Sort(vs)
+		return nil, fmt.Errorf("patches are from multiple revisions of the series: %s", strings.Join(vs, ", "))
+	}
+
+	total := patchPosition(patches[0]).Total
+	byNumber := make(map[int]*Patch)
+	for i, p := range patches {
+		pos := patchPosition(p)
+		switch {
+		case pos.Total != total:
+			return nil, fmt.Errorf("patch %s is numbered %d/%d, but patch %s is numbered out of %d", describePatch(p), pos.Number, pos.Total, describePatch(patches[0]), total)
+		case pos.Number < 1 || pos.Number > total:
+			return nil, fmt.Errorf("patch %s has invalid number %d/%d", describePatch(p), pos.Number, pos.Total)
+		case byNumber[pos.Number] != nil:
+			return nil, fmt.Errorf("duplicate patch %d/%d: %s and %s", pos.Number, total, describePatch(*byNumber[pos.Number]), describePatch(p))
+		}
+		byNumber[pos.Number] = &patches[i]
+	}
+
+	var missing []string
+	ordered := make([]Patch, 0, len(patches))
+	for n := 1; n <= total; n++ {
+		if byNumber[n] == nil {
+			missing = append(missing, fmt.Sprintf("%d/%d", n, total))
+			continue
+		}
+		ordered = append(ordered, *byNumber[n])
+	}
+	if len(missing) > 0 && !partial {
+		return nil, fmt.Errorf("series is incomplete: missing %s", strings.Join(missing, ", "))
+	}
+	return ordered, nil
+}
+
+func patchPosition(p Patch) seriesPosition {
+	if p.header == nil {
+		return seriesPosition{Version: 1}
+	}
+	return parseSubjectPrefix(p.header.SubjectPrefix)
+}
+
+func describePatch(p Patch) string {
+	if p.header != nil && p.header.Title != "" {
+		return fmt.Sprintf("%q (%s)", p.header.Title, p.path)
+	}
+	return p.path
+}
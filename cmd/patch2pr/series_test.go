@@ -0,0 +1,159 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/bluekeyes/go-gitdiff/gitdiff"
+)
+
+func TestParseSubjectPrefix(t *testing.T) {
+	tests := map[string]seriesPosition{
+		"":                  {Version: 1},
+		"[PATCH] ":          {Version: 1},
+		"[PATCH 0/3] ":      {Version: 1, Number: 0, Total: 3},
+		"[PATCH v2 2/3] ":   {Version: 2, Number: 2, Total: 3},
+		"[RFC][PATCH 1/2] ": {Version: 1, Number: 1, Total: 2},
+		"[PATCH v4 10/12] ": {Version: 4, Number: 10, Total: 12},
+		"[PATCH a/b] ":      {Version: 1},
+		"[PATCH 1/0] ":      {Version: 1},
+	}
+
+	for prefix, expected := range tests {
+		if got := parseSubjectPrefix(prefix); got != expected {
+			t.Errorf("incorrect position for %q: expected %+v, got %+v", prefix, expected, got)
+		}
+	}
+}
+
+func TestSplitCoverLetter(t *testing.T) {
+	patches, err := parse("testdata/cover.mbox", parseOptions{})
+	if err != nil {
+		t.Fatalf("unexpected parse error: %v", err)
+	}
+
+	cover, rest, err := splitCoverLetter(patches)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cover == nil {
+		t.Fatal("expected cover letter, but got nil")
+	}
+	if len(rest) != 1 {
+		t.Fatalf("expected 1 patch after removing cover letter, got %d", len(rest))
+	}
+	if rest[0].header.Title != "Say hello to everyone" {
+		t.Errorf("incorrect remaining patch: %q", rest[0].header.Title)
+	}
+
+	title, body := coverLetterText(cover)
+	if title != "Improve the greeting" {
+		t.Errorf("incorrect title: %q", title)
+	}
+	if expected := "This series makes the greeting\nmore friendly."; body != expected {
+		t.Errorf("incorrect body:\nexpected: %q\n  actual: %q", expected, body)
+	}
+
+	if _, _, err := splitCoverLetter(append(patches, patches[0])); err == nil {
+		t.Error("expected error with multiple cover letters, but got nil")
+	}
+}
+
+func TestCoverLetterTextPlaceholders(t *testing.T) {
+	title, body := coverLetterText(&gitdiff.PatchHeader{
+		Title: "*** SUBJECT HERE ***",
+		Body:  "*** BLURB HERE ***\n\nTest (2):\n  One\n  Two",
+	})
+	if title != "" || body != "" {
+		t.Errorf("expected empty title and body, got %q and %q", title, body)
+	}
+}
+
+func TestStripTitlePrefix(t *testing.T) {
+	tests := map[string][2]string{
+		"[PATCH v2 1/3] Fix parser": {"[PATCH v2 1/3] ", "Fix parser"},
+		"[RFC][PATCH] Add feature":  {"[RFC][PATCH] ", "Add feature"},
+		"[docs] Update readme":      {"", "[docs] Update readme"},
+		"Plain title":               {"", "Plain title"},
+	}
+
+	for title, expected := range tests {
+		h := &gitdiff.PatchHeader{Title: title}
+		stripTitlePrefix(h)
+		if h.SubjectPrefix != expected[0] || h.Title != expected[1] {
+			t.Errorf("incorrect result for %q: expected %q and %q, got %q and %q", title, expected[0], expected[1], h.SubjectPrefix, h.Title)
+		}
+	}
+}
+
+func TestOrderSeries(t *testing.T) {
+	patch := func(prefix, title string) Patch {
+		return Patch{path: "test.mbox", header: &gitdiff.PatchHeader{SubjectPrefix: prefix, Title: title}}
+	}
+	titles := func(patches []Patch) []string {
+		var ts []string
+		for _, p := range patches {
+			ts = append(ts, p.header.Title)
+		}
+		return ts
+	}
+
+	tests := map[string]struct {
+		Patches []Patch
+		Partial bool
+		Titles  []string
+		Err     string
+	}{
+		"unnumbered": {
+			Patches: []Patch{patch("[PATCH] ", "B"), patch("", "A")},
+			Titles:  []string{"B", "A"},
+		},
+		"reordered": {
+			Patches: []Patch{patch("[PATCH v2 3/3] ", "C"), patch("[PATCH v2 1/3] ", "A"), patch("[PATCH v2 2/3] ", "B")},
+			Titles:  []string{"A", "B", "C"},
+		},
+		"missing": {
+			Patches: []Patch{patch("[PATCH 3/4] ", "C"), patch("[PATCH 1/4] ", "A")},
+			Err:     "series is incomplete: missing 2/4, 4/4",
+		},
+		"partial": {
+			Patches: []Patch{patch("[PATCH 3/4] ", "C"), patch("[PATCH 1/4] ", "A")},
+			Partial: true,
+			Titles:  []string{"A", "C"},
+		},
+		"duplicate": {
+			Patches: []Patch{patch("[PATCH 1/2] ", "A"), patch("[PATCH 1/2] ", "B")},
+			Err:     `duplicate patch 1/2: "A" (test.mbox) and "B" (test.mbox)`,
+		},
+		"mixedVersions": {
+			Patches: []Patch{patch("[PATCH 1/2] ", "A"), patch("[PATCH v2 2/2] ", "B")},
+			Err:     "patches are from multiple revisions of the series: v1, v2",
+		},
+		"mixedTotals": {
+			Patches: []Patch{patch("[PATCH 1/2] ", "A"), patch("[PATCH 2/3] ", "B")},
+			Err:     `patch "B" (test.mbox) is numbered 2/3, but patch "A" (test.mbox) is numbered out of 2`,
+		},
+		"mixedNumbering": {
+			Patches: []Patch{patch("[PATCH 1/1] ", "A"), patch("[PATCH] ", "B")},
+			Err:     `patch "B" (test.mbox) has no series number, but other patches do`,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			ordered, err := orderSeries(test.Patches, test.Partial)
+			if test.Err != "" {
+				if err == nil || err.Error() != test.Err {
+					t.Fatalf("incorrect error: expected %q, got %v", test.Err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := titles(ordered); !reflect.DeepEqual(test.Titles, got) {
+				t.Errorf("incorrect order: expected %q, got %q", test.Titles, got)
+			}
+		})
+	}
+}
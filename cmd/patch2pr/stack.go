@@ -0,0 +1,278 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/google/go-github/v89/github"
+
+	"github.com/bluekeyes/patch2pr"
+)
+
+type StackEntryResult struct {
+	Branch      string             `json:"branch"`
+	Commit      string             `json:"commit"`
+	Source      string             `json:"source"`
+	PullRequest *PullRequestResult `json:"pull_request"`
+}
+
+type stackEntry struct {
+	branch string
+	source string
+	commit *github.Commit
+	pr     *patch2pr.PullRequest
+}
+
+// executeStack creates one branch and one pull request for each patch. The
+// pull request for the first patch targets baseBranch and the pull request for
+// each later patch targets the branch of the previous patch.
+func executeStack(ctx context.Context, client *github.Client, prs *patch2pr.GraphQLPullRequests, repo patch2pr.Repository, applier *patch2pr.Applier, patches []Patch, baseBranch, headBranch string, opts *Options) (*Result, error) {
+	var warnings applyWarnings
+	entries := make([]stackEntry, len(patches))
+	for i := range patches {
+		commits, entryWarnings, err := applyPatches(ctx, applier, patches[i:i+1], opts)
+		if err != nil {
+			return nil, fmt.Errorf("patch %d: %w", i+1, err)
+		}
+		warnings.append(entryWarnings)
+		entries[i] = stackEntry{
+			branch: stackBranch(headBranch, i),
+			source: patches[i].path,
+			commit: commits[0],
+		}
+	}
+
+	// Check all branches before updating any of them so that a failure does
+	// not leave the stack partially updated
+	refs := make([]*patch2pr.Reference, len(entries))
+	for i, e := range entries {
+		refs[i] = patch2pr.NewReference(client, repo, "refs/heads/"+e.branch)
+		if opts.Force {
+			continue
+		}
+
+		current, exists, err := refs[i].Get(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			continue
+		}
+
+		cmp, _, err := client.Repositories.CompareCommits(ctx, repo.Owner, repo.Name, current, e.commit.GetSHA(), &github.ListOptions{PerPage: 1})
+		if err != nil {
+			return nil, fmt.Errorf("compare branch %q failed: %w", e.branch, err)
+		}
+		if s := cmp.GetStatus(); s != "ahead" && s != "identical" {
+			return nil, fmt.Errorf("branch %q exists and updating it is not a fast-forward; use -force to replace the stack", e.branch)
+		}
+	}
+
+	for i, e := range entries {
+		if err := refs[i].Set(ctx, e.commit.GetSHA(), opts.Force); err != nil {
+			return nil, fmt.Errorf("set ref for %q failed: %w", e.branch, err)
+		}
+	}
+
+	res := &Result{Fuzzy: warnings.fuzzy, Whitespace: warnings.whitespace}
+
+	created, closed, err := updateStackPullRequests(ctx, prs, repo, entries, baseBranch, headBranch, opts)
+	if err != nil {
+		return nil, err
+	}
+	for _, pr := range closed {
+		fmt.Fprintf(os.Stderr, "Closed pull request #%d for branch %q, which is no longer part of the stack\n", pr.Number, pr.HeadRefName)
+		res.Closed = append(res.Closed, PullRequestResult{Number: pr.Number, URL: pr.URL})
+	}
+
+	for i := range entries {
+		pr := entries[i].pr
+		prRes := &PullRequestResult{
+			Number:  pr.Number,
+			URL:     pr.URL,
+			Updated: !created[i],
+		}
+		res.Errors = append(res.Errors, finishPullRequest(ctx, client, prs, repo, pr, prRes, opts)...)
+
+		res.Stack = append(res.Stack, StackEntryResult{
+			Branch:      entries[i].branch,
+			Commit:      entries[i].commit.GetSHA(),
+			Source:      entries[i].source,
+			PullRequest: prRes,
+		})
+	}
+
+	last := entries[len(entries)-1]
+	res.Commit = last.commit.GetSHA()
+	res.Tree = last.commit.GetTree().GetSHA()
+	res.PullRequest = res.Stack[len(res.Stack)-1].PullRequest
+
+	if opts.Wait {
+		checks, err := waitForChecks(ctx, client, repo, res.Commit, opts.WaitTimeout)
+		res.Checks = checks
+		if err != nil {
+			res.Errors = append(res.Errors, err.Error())
+		}
+	}
+
+	return res, nil
+}
+
+// stackPullRequests creates, updates, and closes the pull requests of a stack.
+type stackPullRequests interface {
+	Find(ctx context.Context, head patch2pr.Repository, branch string) (*patch2pr.PullRequest, error)
+	CreateOrUpdate(ctx context.Context, head patch2pr.Repository, branch string, spec patch2pr.PullRequestSpec) (*patch2pr.PullRequest, bool, error)
+	Update(ctx context.Context, pr *patch2pr.PullRequest, spec patch2pr.PullRequestSpec) (*patch2pr.PullRequest, error)
+	Close(ctx context.Context, pr *patch2pr.PullRequest) error
+}
+
+// updateStackPullRequests creates or updates the pull request for each entry
+// and then adds a navigation table to each one. Existing pull requests get
+// the new base branch, but keep their title and body, except for the table.
+// It also closes the open pull requests for the branches after the end of the
+// stack, which remain from a longer previous version of the stack.
+//
+// To find pull requests after gaps, like a pull request that was merged by
+// hand, it checks branches up to the size of the previous stack, as recorded
+// in the tables of the existing pull requests. It returns whether each pull
+// request was created and the closed pull requests.
+func updateStackPullRequests(ctx context.Context, prs stackPullRequests, repo patch2pr.Repository, entries []stackEntry, baseBranch, headBranch string, opts *Options) ([]bool, []*patch2pr.PullRequest, error) {
+	// The size of the previous version of the stack, from the tables in the
+	// existing pull requests
+	var prevSize int
+
+	created := make([]bool, len(entries))
+	for i := range entries {
+		base := baseBranch
+		if i > 0 {
+			base = entries[i-1].branch
+		}
+
+		spec := stackPullRequestSpec(entries[i], base, opts)
+		spec.UpdateBase = true
+
+		pr, prCreated, err := prs.CreateOrUpdate(ctx, repo, entries[i].branch, spec)
+		if err != nil {
+			return nil, nil, fmt.Errorf("pull request for %q: %w", entries[i].branch, err)
+		}
+		entries[i].pr = pr
+		created[i] = prCreated
+		if !prCreated {
+			prevSize = max(prevSize, stackSize(pr.Body))
+		}
+	}
+
+	// Add navigation after creating all pull requests so every table has the
+	// numbers of all pull requests in the stack
+	for i := range entries {
+		spec := stackPullRequestSpec(entries[i], "", opts)
+		if !created[i] {
+			spec.Body = withoutStackTable(entries[i].pr.Body)
+		}
+		spec.Body = joinParagraphs(spec.Body, stackTable(entries, i))
+		spec.UpdateBody = true
+
+		pr, err := prs.Update(ctx, entries[i].pr, spec)
+		if err != nil {
+			return nil, nil, fmt.Errorf("pull request for %q: %w", entries[i].branch, err)
+		}
+		entries[i].pr = pr
+	}
+
+	var closed []*patch2pr.PullRequest
+	for i := len(entries); ; i++ {
+		branch := stackBranch(headBranch, i)
+		pr, err := prs.Find(ctx, repo, branch)
+		if err != nil {
+			return nil, nil, fmt.Errorf("pull request for %q: %w", branch, err)
+		}
+		if pr == nil {
+			// Pull requests may be closed or merged by hand, so keep looking
+			// until the end of the previous stack
+			if i+1 >= prevSize {
+				break
+			}
+			continue
+		}
+		prevSize = max(prevSize, stackSize(pr.Body))
+
+		if err := prs.Close(ctx, pr); err != nil {
+			return nil, nil, fmt.Errorf("pull request for %q: %w", branch, err)
+		}
+		closed = append(closed, pr)
+	}
+	return created, closed, nil
+}
+
+func stackBranch(headBranch string, i int) string {
+	return fmt.Sprintf("%s-%d", headBranch, i+1)
+}
+
+func stackPullRequestSpec(e stackEntry, base string, opts *Options) patch2pr.PullRequestSpec {
+	title, body := splitMessage(e.commit.GetMessage())
+	spec := pullRequestSpec(title, body, base, opts)
+
+	// Stacks ignore -pull-title and -pull-body, so keep existing edits
+	spec.UpdateTitle = false
+	spec.UpdateBody = false
+	return spec
+}
+
+// stackTable returns a Markdown table that links to each pull request in a
+// stack and marks the current pull request.
+func stackTable(entries []stackEntry, current int) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "---\n\n**Stack** (%d of %d)\n\n", current+1, len(entries))
+	b.WriteString("| | Pull Request | Title |\n")
+	b.WriteString("| --- | --- | --- |\n")
+	for i, e := range entries {
+		var marker string
+		if i == current {
+			marker = "→"
+		}
+		title := strings.ReplaceAll(e.pr.Title, "|", `\|`)
+		fmt.Fprintf(&b, "| %s | #%d | %s |\n", marker, e.pr.Number, title)
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// withoutStackTable removes the table added by stackTable from the end of a
+// pull request body.
+func withoutStackTable(body string) string {
+	const start = "---\n\n**Stack** ("
+	if strings.HasPrefix(body, start) {
+		return ""
+	}
+	if i := strings.LastIndex(body, "\n"+start); i >= 0 {
+		return strings.TrimSpace(body[:i])
+	}
+	return body
+}
+
+// stackSize returns the number of pull requests in the table added by
+// stackTable to a pull request body or 0 if the body has no table.
+func stackSize(body string) int {
+	const start = "**Stack** ("
+	i := strings.LastIndex(body, start)
+	if i < 0 {
+		return 0
+	}
+
+	var current, size int
+	if _, err := fmt.Sscanf(body[i+len(start):], "%d of %d)", &current, &size); err != nil {
+		return 0
+	}
+	return size
+}
+
+func joinParagraphs(parts ...string) string {
+	var nonEmpty []string
+	for _, p := range parts {
+		if p = strings.TrimSpace(p); p != "" {
+			nonEmpty = append(nonEmpty, p)
+		}
+	}
+	return strings.Join(nonEmpty, "\n\n")
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/bluekeyes/patch2pr"
+	"github.com/google/go-github/v89/github"
+)
+
+func TestStackTable(t *testing.T) {
+	entries := []stackEntry{
+		{pr: &patch2pr.PullRequest{Number: 12, Title: "Add feature"}},
+		{pr: &patch2pr.PullRequest{Number: 13, Title: "Fix a | b"}},
+	}
+
+	expected := `---
+
+**Stack** (2 of 2)
+
+| | Pull Request | Title |
+| --- | --- | --- |
+|  | #12 | Add feature |
+| → | #13 | Fix a \| b |`
+
+	if got := stackTable(entries, 1); got != expected {
+		t.Errorf("incorrect table:\nexpected: %q\n  actual: %q", expected, got)
+	}
+}
+
+func TestStackBranch(t *testing.T) {
+	if got := stackBranch("patch2pr", 0); got != "patch2pr-1" {
+		t.Errorf("incorrect branch: expected %q, got %q", "patch2pr-1", got)
+	}
+}
+
+func TestWithoutStackTable(t *testing.T) {
+	entries := []stackEntry{
+		{pr: &patch2pr.PullRequest{Number: 12, Title: "Add feature"}},
+	}
+	table := stackTable(entries, 0)
+
+	tests := map[string]struct {
+		Body     string
+		Expected string
+	}{
+		"noTable":   {"Edited on GitHub", "Edited on GitHub"},
+		"onlyTable": {table, ""},
+		"withTable": {joinParagraphs("Edited on GitHub\n\n---\n\nA separator", table), "Edited on GitHub\n\n---\n\nA separator"},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := withoutStackTable(test.Body); got != test.Expected {
+				t.Errorf("incorrect body: expected %q, actual %q", test.Expected, got)
+			}
+		})
+	}
+}
+
+func TestUpdateStackPullRequests(t *testing.T) {
+	repo := patch2pr.Repository{Owner: "o", Name: "r"}
+
+	tests := map[string]Options{
+		"noFlags": {},
+		// Stacks ignore these flags, so they must not replace edits
+		"pullTitle": {PullTitle: "Flag title", PullBody: "Flag body"},
+	}
+
+	for name, opts := range tests {
+		t.Run(name, func(t *testing.T) {
+			// The previous version of the stack had three patches and the
+			// first pull request has a body that was edited on GitHub
+			prs := &fakeStackPullRequests{
+				prs: map[string]*patch2pr.PullRequest{
+					"patch2pr-1": {Number: 1, Title: "Old first", Body: "Edited on GitHub", BaseRefName: "main", HeadRefName: "patch2pr-1"},
+					"patch2pr-2": {Number: 2, Title: "Old second", BaseRefName: "old-base", HeadRefName: "patch2pr-2"},
+					"patch2pr-3": {Number: 3, Title: "Old third", BaseRefName: "patch2pr-2", HeadRefName: "patch2pr-3"},
+				},
+				next: 4,
+			}
+
+			entries := []stackEntry{
+				{branch: "patch2pr-1", commit: &github.Commit{Message: github.Ptr("First\n\nFirst body")}},
+				{branch: "patch2pr-2", commit: &github.Commit{Message: github.Ptr("Second\n\nSecond body")}},
+			}
+
+			created, closed, err := updateStackPullRequests(context.Background(), prs, repo, entries, "main", "patch2pr", &opts)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if created[0] || created[1] {
+				t.Errorf("incorrect created pull requests: expected none, actual %v", created)
+			}
+			if len(closed) != 1 || closed[0].Number != 3 {
+				t.Fatalf("incorrect closed pull requests: expected [#3], actual %v", closed)
+			}
+			if _, ok := prs.prs["patch2pr-3"]; ok {
+				t.Error("pull request for patch2pr-3 is still open")
+			}
+
+			first, second := entries[0].pr, entries[1].pr
+			if first.Title != "Old first" {
+				t.Errorf("incorrect title: expected %q, actual %q", "Old first", first.Title)
+			}
+			if second.Title != "Old second" {
+				t.Errorf("incorrect title: expected %q, actual %q", "Old second", second.Title)
+			}
+			if !strings.HasPrefix(first.Body, "Edited on GitHub\n\n---") {
+				t.Errorf("incorrect body: edits were not kept: %q", first.Body)
+			}
+			if !strings.HasPrefix(second.Body, "---") {
+				t.Errorf("incorrect body: expected only a table, actual %q", second.Body)
+			}
+			if second.BaseRefName != "patch2pr-1" {
+				t.Errorf("incorrect base: expected %q, actual %q", "patch2pr-1", second.BaseRefName)
+			}
+
+			for _, pr := range []*patch2pr.PullRequest{first, second} {
+				if strings.Count(pr.Body, "**Stack**") != 1 {
+					t.Errorf("incorrect number of tables in #%d: %q", pr.Number, pr.Body)
+				}
+				if !strings.Contains(pr.Body, " of 2)") || strings.Contains(pr.Body, "#3") {
+					t.Errorf("incorrect table in #%d: %q", pr.Number, pr.Body)
+				}
+			}
+		})
+	}
+}
+
+func TestUpdateStackPullRequestsGap(t *testing.T) {
+	repo := patch2pr.Repository{Owner: "o", Name: "r"}
+
+	// The previous version of the stack had five patches, but the pull
+	// request for the third was merged by hand
+	table := "---\n\n**Stack** (1 of 5)\n\n| | Pull Request | Title |"
+	prs := &fakeStackPullRequests{
+		prs: map[string]*patch2pr.PullRequest{
+			"patch2pr-1": {Number: 1, Title: "Old first", Body: table, BaseRefName: "main", HeadRefName: "patch2pr-1"},
+			"patch2pr-4": {Number: 4, Title: "Old fourth", BaseRefName: "patch2pr-3", HeadRefName: "patch2pr-4"},
+			"patch2pr-5": {Number: 5, Title: "Old fifth", BaseRefName: "patch2pr-4", HeadRefName: "patch2pr-5"},
+		},
+		next: 6,
+	}
+
+	entries := []stackEntry{
+		{branch: "patch2pr-1", commit: &github.Commit{Message: github.Ptr("First")}},
+		{branch: "patch2pr-2", commit: &github.Commit{Message: github.Ptr("Second")}},
+	}
+
+	_, closed, err := updateStackPullRequests(context.Background(), prs, repo, entries, "main", "patch2pr", &Options{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var numbers []int
+	for _, pr := range closed {
+		numbers = append(numbers, pr.Number)
+	}
+	if len(numbers) != 2 || numbers[0] != 4 || numbers[1] != 5 {
+		t.Errorf("incorrect closed pull requests: expected [4 5], actual %v", numbers)
+	}
+}
+
+func TestStackSize(t *testing.T) {
+	entries := []stackEntry{
+		{pr: &patch2pr.PullRequest{Number: 12, Title: "Add feature"}},
+		{pr: &patch2pr.PullRequest{Number: 13, Title: "Fix bug"}},
+	}
+
+	tests := map[string]struct {
+		Body     string
+		Expected int
+	}{
+		"noTable":   {"Edited on GitHub", 0},
+		"withTable": {joinParagraphs("Edited on GitHub", stackTable(entries, 1)), 2},
+		"invalid":   {"**Stack** (one of two)", 0},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := stackSize(test.Body); got != test.Expected {
+				t.Errorf("incorrect size: expected %d, actual %d", test.Expected, got)
+			}
+		})
+	}
+}
+
+func TestUpdateStackPullRequestsCreate(t *testing.T) {
+	repo := patch2pr.Repository{Owner: "o", Name: "r"}
+	prs := &fakeStackPullRequests{prs: map[string]*patch2pr.PullRequest{}, next: 1}
+
+	entries := []stackEntry{
+		{branch: "patch2pr-1", commit: &github.Commit{Message: github.Ptr("First\n\nFirst body")}},
+		{branch: "patch2pr-2", commit: &github.Commit{Message: github.Ptr("Second")}},
+	}
+
+	created, closed, err := updateStackPullRequests(context.Background(), prs, repo, entries, "main", "patch2pr", &Options{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !created[0] || !created[1] {
+		t.Errorf("incorrect created pull requests: expected all, actual %v", created)
+	}
+	if len(closed) != 0 {
+		t.Errorf("incorrect closed pull requests: expected none, actual %v", closed)
+	}
+
+	if base := entries[0].pr.BaseRefName; base != "main" {
+		t.Errorf("incorrect base: expected %q, actual %q", "main", base)
+	}
+	if base := entries[1].pr.BaseRefName; base != "patch2pr-1" {
+		t.Errorf("incorrect base: expected %q, actual %q", "patch2pr-1", base)
+	}
+
+	expected := joinParagraphs("First body", stackTable(entries, 0))
+	if body := entries[0].pr.Body; body != expected {
+		t.Errorf("incorrect body:\nexpected: %q\n  actual: %q", expected, body)
+	}
+}
+
+// fakeStackPullRequests stores open pull requests by head branch and updates
+// them like GraphQLPullRequests.
+type fakeStackPullRequests struct {
+	prs  map[string]*patch2pr.PullRequest
+	next int
+}
+
+func (f *fakeStackPullRequests) Find(ctx context.Context, head patch2pr.Repository, branch string) (*patch2pr.PullRequest, error) {
+	return f.prs[branch], nil
+}
+
+func (f *fakeStackPullRequests) CreateOrUpdate(ctx context.Context, head patch2pr.Repository, branch string, spec patch2pr.PullRequestSpec) (*patch2pr.PullRequest, bool, error) {
+	if pr := f.prs[branch]; pr != nil {
+		pr, err := f.Update(ctx, pr, spec)
+		return pr, false, err
+	}
+
+	pr := &patch2pr.PullRequest{
+		Number:      f.next,
+		Title:       spec.Title,
+		Body:        spec.Body,
+		IsDraft:     spec.Draft,
+		BaseRefName: spec.Base,
+		HeadRefName: branch,
+	}
+	f.prs[branch] = pr
+	f.next++
+	return pr, true, nil
+}
+
+func (f *fakeStackPullRequests) Update(ctx context.Context, pr *patch2pr.PullRequest, spec patch2pr.PullRequestSpec) (*patch2pr.PullRequest, error) {
+	updated := *pr
+	if spec.UpdateTitle {
+		updated.Title = spec.Title
+	}
+	if spec.UpdateBody {
+		updated.Body = spec.Body
+	}
+	if spec.UpdateDraft {
+		updated.IsDraft = spec.Draft
+	}
+	if spec.UpdateBase && spec.Base != "" {
+		updated.BaseRefName = spec.Base
+	}
+	f.prs[updated.HeadRefName] = &updated
+	return &updated, nil
+}
+
+func (f *fakeStackPullRequests) Close(ctx context.Context, pr *patch2pr.PullRequest) error {
+	delete(f.prs, pr.HeadRefName)
+	return nil
+}
@@ -1,6 +1,8 @@
 package main
 
 import (
+	"strings"
+
 	"github.com/bluekeyes/patch2pr"
 )
 
@@ -43,3 +45,25 @@ func (v ForkValue) Set(s string) error {
 	*v.enabled = true
 	return nil
 }
+
+// StringListValue is a flag that may be set multiple times. Each value may
+// also contain a comma-separated list of items.
+type StringListValue struct {
+	list *[]string
+}
+
+func (v StringListValue) String() string {
+	if v.list == nil {
+		return ""
+	}
+	return strings.Join(*v.list, ",")
+}
+
+func (v StringListValue) Set(s string) error {
+	for item := range strings.SplitSeq(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			*v.list = append(*v.list, item)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package patch2pr
+
+import (
+	"bytes"
+	"context"
+	"strings"
+
+	"github.com/bluekeyes/go-gitdiff/gitdiff"
+)
+
+// lineEnding is how an applier converts line endings when applying a patch
+// to a file.
+type lineEnding int
+
+const (
+	// lineEndingNone applies the patch to the file exactly
+	lineEndingNone lineEnding = iota
+
+	// lineEndingLF applies the patch ignoring the difference between LF and
+	// CRLF and writes the result with LF, the normalized form Git uses to
+	// store text files in a repository
+	lineEndingLF
+
+	// lineEndingCRLF applies the patch ignoring the difference between LF
+	// and CRLF and writes the result with CRLF, keeping the line endings of a
+	// file that uses CRLF without attributes that normalize it
+	lineEndingCRLF
+)
+
+// detectLineEnding returns how to convert line endings when applying f to the
+// content src of filePath, using the .gitattributes files in the repository.
+//
+// Like Git, text files are stored with LF. Files with the text attribute are
+// always text. With text=auto, files are text unless they look binary or
+// already use CRLF. Files without attributes keep their line endings: if every
+// line in src ends with CRLF, added lines also use CRLF.
+func detectLineEnding(ctx context.Context, filePath string, src []byte, f *gitdiff.File, read attributesReader) (lineEnding, error) {
+	if f.IsBinary || len(f.TextFragments) == 0 {
+		return lineEndingNone, nil
+	}
+
+	text, err := lookupTextAttr(ctx, filePath, read)
+	if err != nil {
+		return lineEndingNone, err
+	}
+
+	switch text {
+	case textSet:
+		return lineEndingLF, nil
+	case textUnset:
+		return lineEndingNone, nil
+	case textAuto:
+		if isBinaryData(src) {
+			return lineEndingNone, nil
+		}
+		if !bytes.Contains(src, []byte("\r\n")) {
+			return lineEndingLF, nil
+		}
+	}
+	if usesCRLF(src) {
+		return lineEndingCRLF, nil
+	}
+	return lineEndingNone, nil
+}
+
+// usesCRLF returns true if data has at least one line and every line ending
+// in data is CRLF.
+func usesCRLF(data []byte) bool {
+	lf := bytes.Count(data, []byte("\n"))
+	return lf > 0 && lf == bytes.Count(data, []byte("\r\n"))
+}
+
+// isBinaryData returns true if data looks binary to Git, which checks for a
+// NUL byte in the first 8000 bytes.
+func isBinaryData(data []byte) bool {
+	return bytes.IndexByte(data[:min(len(data), 8000)], 0) >= 0
+}
+
+// normalizeLineEndings replaces CRLF with LF in src and in the lines of the
+// text fragments of f, unless eol is lineEndingNone. It returns a copy of f
+// if any lines changed.
+func normalizeLineEndings(src []byte, f *gitdiff.File, eol lineEnding) ([]byte, *gitdiff.File) {
+	if eol == lineEndingNone {
+		return src, f
+	}
+	src = bytes.ReplaceAll(src, []byte("\r\n"), []byte("\n"))
+
+	var changed bool
+	frags := make([]*gitdiff.TextFragment, len(f.TextFragments))
+	for i, frag := range f.TextFragments {
+		frags[i] = frag
+		for j, line := range frag.Lines {
+			if !strings.HasSuffix(line.Line, "\r\n") {
+				continue
+			}
+			if frags[i] == frag {
+				normalized := *frag
+				normalized.Lines = make([]gitdiff.Line, len(frag.Lines))
+				copy(normalized.Lines, frag.Lines)
+				frags[i] = &normalized
+			}
+			frags[i].Lines[j].Line = strings.TrimSuffix(line.Line, "\r\n") + "\n"
+			changed = true
+		}
+	}
+
+	if !changed {
+		return src, f
+	}
+
+	normalized := *f
+	normalized.TextFragments = frags
+	return src, &normalized
+}
+
+// convertLineEndings converts the LF line endings in data, the result of
+// applying a normalized patch, to the line endings for eol.
+func convertLineEndings(data []byte, eol lineEnding) []byte {
+	if eol != lineEndingCRLF {
+		return data
+	}
+	return bytes.ReplaceAll(data, []byte("\n"), []byte("\r\n"))
+}
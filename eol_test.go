@@ -0,0 +1,127 @@
+package patch2pr
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/bluekeyes/go-gitdiff/gitdiff"
+)
+
+func TestApplyLineEndings(t *testing.T) {
+	const lfPatch = "@@ -1,3 +1,3 @@\n one\n-two\n+TWO\n three\n"
+	const crlfPatch = "@@ -1,3 +1,3 @@\n one\r\n-two\r\n+TWO\r\n three\r\n"
+
+	tests := map[string]struct {
+		Attributes string
+		Src        string
+		Patch      string
+		EOL        lineEnding
+		Result     string
+		Conflict   bool
+	}{
+		"lfFile": {
+			Src:    "one\ntwo\nthree\n",
+			Patch:  lfPatch,
+			EOL:    lineEndingNone,
+			Result: "one\nTWO\nthree\n",
+		},
+		"crlfFile": {
+			Src:    "one\r\ntwo\r\nthree\r\n",
+			Patch:  lfPatch,
+			EOL:    lineEndingCRLF,
+			Result: "one\r\nTWO\r\nthree\r\n",
+		},
+		"crlfFileCRLFPatch": {
+			Src:    "one\r\ntwo\r\nthree\r\n",
+			Patch:  crlfPatch,
+			EOL:    lineEndingCRLF,
+			Result: "one\r\nTWO\r\nthree\r\n",
+		},
+		"mixedFile": {
+			Src:      "one\r\ntwo\nthree\r\n",
+			Patch:    lfPatch,
+			EOL:      lineEndingNone,
+			Conflict: true,
+		},
+		"textCRLFPatch": {
+			Attributes: "*.txt text\n",
+			Src:        "one\ntwo\nthree\n",
+			Patch:      crlfPatch,
+			EOL:        lineEndingLF,
+			Result:     "one\nTWO\nthree\n",
+		},
+		"textNormalizesFile": {
+			Attributes: "*.txt text eol=crlf\n",
+			Src:        "one\r\ntwo\r\nthree\r\n",
+			Patch:      lfPatch,
+			EOL:        lineEndingLF,
+			Result:     "one\nTWO\nthree\n",
+		},
+		"autoKeepsCRLF": {
+			Attributes: "* text=auto\n",
+			Src:        "one\r\ntwo\r\nthree\r\n",
+			Patch:      lfPatch,
+			EOL:        lineEndingCRLF,
+			Result:     "one\r\nTWO\r\nthree\r\n",
+		},
+		"autoCRLFPatch": {
+			Attributes: "* text=auto\n",
+			Src:        "one\ntwo\nthree\n",
+			Patch:      crlfPatch,
+			EOL:        lineEndingLF,
+			Result:     "one\nTWO\nthree\n",
+		},
+		"binaryAttribute": {
+			Attributes: "*.txt binary\n",
+			Src:        "one\r\ntwo\r\nthree\r\n",
+			Patch:      lfPatch,
+			EOL:        lineEndingNone,
+			Conflict:   true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			read := func(ctx context.Context, filePath string) (*gitAttributes, error) {
+				if test.Attributes == "" || filePath != gitAttributesFile {
+					return nil, nil
+				}
+				return parseGitAttributes([]byte(test.Attributes)), nil
+			}
+
+			patch := "diff --git a/file.txt b/file.txt\n--- a/file.txt\n+++ b/file.txt\n" + test.Patch
+			files, _, err := gitdiff.Parse(strings.NewReader(patch))
+			if err != nil {
+				t.Fatalf("unexpected error parsing patch: %v", err)
+			}
+
+			eol, err := detectLineEnding(context.Background(), "file.txt", []byte(test.Src), files[0], read)
+			if err != nil {
+				t.Fatalf("unexpected error detecting line ending: %v", err)
+			}
+			if eol != test.EOL {
+				t.Errorf("incorrect line ending: want %d, got %d", test.EOL, eol)
+			}
+
+			adjusted, err := adjustFile([]byte(test.Src), files[0], "file.txt", eol, matchOptions{}, WhitespaceNoWarn)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			b, err := adjusted.apply("file.txt")
+			if test.Conflict {
+				if err == nil {
+					t.Fatal("expected conflict applying patch, but got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error applying patch: %v", err)
+			}
+			if got := string(b); got != test.Result {
+				t.Errorf("incorrect result:\nwant: %q\n got: %q", test.Result, got)
+			}
+		})
+	}
+}
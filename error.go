@@ -36,3 +36,54 @@ func IsUnsupported(err error) bool {
 	}
 	return errors.As(err, &u) && u.Unsupported()
 }
+
+// PayloadTooLargeError is returned when the changes for a commit exceed the
+// maximum request size configured for an applier.
+type PayloadTooLargeError struct {
+	// The size in bytes of the payload or file that exceeds the limit.
+	Size int
+	// The configured limit in bytes.
+	Limit int
+	// The path to the file that exceeds the limit on its own, if any.
+	File string
+}
+
+func (err *PayloadTooLargeError) Error() string {
+	if err.File != "" {
+		return fmt.Sprintf("%s: payload too large: %d bytes exceeds limit of %d bytes", err.File, err.Size, err.Limit)
+	}
+	return fmt.Sprintf("payload too large: %d bytes exceeds limit of %d bytes", err.Size, err.Limit)
+}
+
+// RefMismatchError is returned when a conditional reference update fails
+// because the reference does not have the expected value.
+type RefMismatchError struct {
+	// The full name of the reference.
+	Ref string
+	// The expected SHA of the reference. Empty if the reference was expected
+	// to not exist.
+	Expected string
+	// The actual SHA of the reference. Empty if the reference does not exist.
+	Actual string
+}
+
+func (err *RefMismatchError) Error() string {
+	expected, actual := err.Expected, err.Actual
+	if expected == "" {
+		expected = "<missing>"
+	}
+	if actual == "" {
+		actual = "<missing>"
+	}
+	return fmt.Sprintf("%s: ref mismatch: expected %s, actual %s", err.Ref, expected, actual)
+}
+
+// BadWhitespaceError is returned when a patch adds lines with whitespace errors
+// and the applier uses WhitespaceError mode.
+type BadWhitespaceError struct {
+	WhitespaceReport
+}
+
+func (err *BadWhitespaceError) Error() string {
+	return "whitespace error: " + err.WhitespaceReport.String()
+}
@@ -0,0 +1,48 @@
+package patch2pr
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestRefMismatchError(t *testing.T) {
+	for i, tc := range []struct {
+		Err   RefMismatchError
+		Error string
+	}{
+		{
+			RefMismatchError{Ref: "refs/heads/test", Expected: "abc", Actual: "def"},
+			"refs/heads/test: ref mismatch: expected abc, actual def",
+		},
+		{
+			RefMismatchError{Ref: "refs/heads/test", Actual: "def"},
+			"refs/heads/test: ref mismatch: expected <missing>, actual def",
+		},
+		{
+			RefMismatchError{Ref: "refs/heads/test", Expected: "abc"},
+			"refs/heads/test: ref mismatch: expected abc, actual <missing>",
+		},
+	} {
+		want := tc.Error
+		if got := tc.Err.Error(); got != want {
+			t.Errorf("case %d: Error(): want %q, got %q", i, want, got)
+		}
+	}
+}
+
+func TestMetadataError(t *testing.T) {
+	err := &MetadataError{
+		Failures: map[string]error{
+			"milestone": errors.New("no open milestone"),
+			"labels":    errors.New("label failure"),
+		},
+	}
+
+	want := "add pull request metadata failed: labels: label failure; milestone: no open milestone"
+	if got := err.Error(); got != want {
+		t.Errorf("Error(): want %q, got %q", want, got)
+	}
+	if !errors.Is(err, err.Failures["labels"]) {
+		t.Errorf("Is(labels failure): want true, got false")
+	}
+}
@@ -0,0 +1,257 @@
+package patch2pr
+
+import (
+	"bytes"
+	"strings"
+	"unicode"
+
+	"github.com/bluekeyes/go-gitdiff/gitdiff"
+)
+
+// FragmentMatch describes a text fragment that applied at a different line or
+// with less context than in the patch.
+type FragmentMatch struct {
+	// The path to the file that contains the fragment.
+	File string
+	// The number of the fragment in the file, starting from 1.
+	Fragment int
+	// The starting line of the fragment in the patch.
+	Line int64
+	// The number of lines between the line in the patch and the line where
+	// the fragment applied. The offset is negative if the fragment applied
+	// before the line in the patch.
+	Offset int64
+	// The number of context lines ignored at the start and at the end of the
+	// fragment.
+	Fuzz int
+}
+
+// matchOptions configure how text fragments match the lines of a file.
+type matchOptions struct {
+	maxOffset int
+	maxFuzz   int
+
+	// ignoreWhitespace allows context lines to match lines that differ only
+	// in the amount of whitespace
+	ignoreWhitespace bool
+}
+
+func (o matchOptions) enabled() bool {
+	return o.maxOffset > 0 || o.maxFuzz > 0 || o.ignoreWhitespace
+}
+
+// matchFragments finds where each text fragment of f applies to src. If all
+// fragments apply exactly at the lines in the patch, it returns f. Otherwise,
+// it returns a copy of f with fragments moved to the lines where they apply,
+// with ignored context removed, and with context lines that differ in
+// whitespace replaced by the lines in src. It also returns a FragmentMatch for
+// each moved or fuzzed fragment and the number of context lines that only
+// matched after ignoring whitespace.
+//
+// Like GNU patch, each fragment is first matched with all of its context,
+// searching up to maxOffset lines before and after the expected line, then
+// with fewer context lines, up to maxFuzz. The expected line includes the
+// offset of the previous fragment. Fragments that do not match anywhere are
+// not changed so that applying them reports a conflict.
+func matchFragments(src []byte, f *gitdiff.File, opts matchOptions) (*gitdiff.File, []FragmentMatch, int) {
+	if !opts.enabled() || f.IsBinary || len(f.TextFragments) == 0 {
+		return f, nil, 0
+	}
+
+	lines := splitLines(src)
+
+	var matches []FragmentMatch
+	var frags []*gitdiff.TextFragment
+	var offset int64
+	var minStart int
+	var changed bool
+	var ignored int
+
+	for i, frag := range f.TextFragments {
+		if frag.OldPosition == 0 || frag.OldLines == 0 {
+			frags = append(frags, frag)
+			continue
+		}
+
+		start, fuzz, ok := findFragment(lines, frag, frag.OldPosition-1+offset, minStart, opts)
+		if !ok {
+			frags = append(frags, frag)
+			continue
+		}
+
+		matched := trimContext(frag, fuzz)
+		matched.OldPosition = int64(start) + 1
+		if frag.NewPosition > 0 {
+			matched.NewPosition += matched.OldPosition - frag.OldPosition
+		}
+		if opts.ignoreWhitespace {
+			n := replaceContext(matched, lines[start:])
+			ignored += n
+			changed = changed || n > 0
+		}
+
+		offset = int64(start-leadingTrim(frag, fuzz)) - (frag.OldPosition - 1)
+		minStart = start + int(matched.OldLines)
+
+		if offset != 0 || fuzz != 0 {
+			changed = true
+			matches = append(matches, FragmentMatch{
+				File:     f.OldName,
+				Fragment: i + 1,
+				Line:     frag.OldPosition,
+				Offset:   offset,
+				Fuzz:     fuzz,
+			})
+		}
+		frags = append(frags, matched)
+	}
+
+	if !changed {
+		return f, nil, 0
+	}
+
+	matched := *f
+	matched.TextFragments = frags
+	return &matched, matches, ignored
+}
+
+// findFragment returns the line where the old lines of frag match lines,
+// starting from 0, and the fuzz needed for the match.
+func findFragment(lines [][]byte, frag *gitdiff.TextFragment, expected int64, minStart int, opts matchOptions) (start int, fuzz int, ok bool) {
+	old := oldLines(frag)
+
+	for fuzz = 0; fuzz <= opts.maxFuzz; fuzz++ {
+		// Stop if there is no more context to ignore
+		if fuzz > 0 && int64(fuzz) > frag.LeadingContext && int64(fuzz) > frag.TrailingContext {
+			break
+		}
+
+		lead, trail := leadingTrim(frag, fuzz), trailingTrim(frag, fuzz)
+		if lead+trail >= len(old) {
+			break
+		}
+		pattern := old[lead : len(old)-trail]
+
+		base := int(expected) + lead
+		for delta := 0; delta <= opts.maxOffset; delta++ {
+			for _, s := range []int{base + delta, base - delta} {
+				if s >= minStart && matchLines(lines, s, pattern, opts.ignoreWhitespace) {
+					return s, fuzz, true
+				}
+				if delta == 0 {
+					break
+				}
+			}
+		}
+	}
+	return 0, 0, false
+}
+
+func leadingTrim(frag *gitdiff.TextFragment, fuzz int) int {
+	return int(min(int64(fuzz), frag.LeadingContext))
+}
+
+func trailingTrim(frag *gitdiff.TextFragment, fuzz int) int {
+	return int(min(int64(fuzz), frag.TrailingContext))
+}
+
+// replaceContext replaces the context lines of frag that differ from lines
+// with the lines, so the file keeps its whitespace. It returns the number of
+// replaced lines.
+func replaceContext(frag *gitdiff.TextFragment, lines [][]byte) int {
+	var replaced int
+
+	newLines := make([]gitdiff.Line, len(frag.Lines))
+	copy(newLines, frag.Lines)
+
+	i := 0
+	for j, line := range newLines {
+		if !line.Old() {
+			continue
+		}
+		if line.Op == gitdiff.OpContext && line.Line != string(lines[i]) {
+			newLines[j].Line = string(lines[i])
+			replaced++
+		}
+		i++
+	}
+
+	if replaced > 0 {
+		frag.Lines = newLines
+	}
+	return replaced
+}
+
+// trimContext returns a copy of frag without up to fuzz context lines at the
+// start and at the end.
+func trimContext(frag *gitdiff.TextFragment, fuzz int) *gitdiff.TextFragment {
+	lead, trail := leadingTrim(frag, fuzz), trailingTrim(frag, fuzz)
+
+	trimmed := *frag
+	trimmed.Lines = frag.Lines[lead : len(frag.Lines)-trail]
+	trimmed.OldLines -= int64(lead + trail)
+	trimmed.NewLines -= int64(lead + trail)
+	trimmed.LeadingContext -= int64(lead)
+	trimmed.TrailingContext -= int64(trail)
+	return &trimmed
+}
+
+// oldLines returns the context and deleted lines of frag.
+func oldLines(frag *gitdiff.TextFragment) []gitdiff.Line {
+	var old []gitdiff.Line
+	for _, line := range frag.Lines {
+		if line.Old() {
+			old = append(old, line)
+		}
+	}
+	return old
+}
+
+// matchLines returns true if pattern matches lines at start. If
+// ignoreWhitespace is true, context lines match lines that differ only in the
+// amount of whitespace.
+func matchLines(lines [][]byte, start int, pattern []gitdiff.Line, ignoreWhitespace bool) bool {
+	if start < 0 || start+len(pattern) > len(lines) {
+		return false
+	}
+	for i, p := range pattern {
+		line := string(lines[start+i])
+		if line == p.Line {
+			continue
+		}
+		if !ignoreWhitespace || p.Op != gitdiff.OpContext || normalizeSpace(line) != normalizeSpace(p.Line) {
+			return false
+		}
+	}
+	return true
+}
+
+// normalizeSpace replaces each sequence of whitespace in s with a single
+// space and removes whitespace at the end of s, like 'git diff -b'.
+func normalizeSpace(s string) string {
+	var b strings.Builder
+	b.Grow(len(s))
+
+	space := false
+	for _, c := range s {
+		if unicode.IsSpace(c) {
+			space = true
+			continue
+		}
+		if space {
+			b.WriteByte(' ')
+		}
+		space = false
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+// splitLines splits data into lines, keeping the line endings.
+func splitLines(data []byte) [][]byte {
+	lines := bytes.SplitAfter(data, []byte("\n"))
+	if len(lines) > 0 && len(lines[len(lines)-1]) == 0 {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
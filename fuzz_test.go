@@ -0,0 +1,163 @@
+package patch2pr
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/bluekeyes/go-gitdiff/gitdiff"
+)
+
+func TestFuzzFragments(t *testing.T) {
+	const patch = `diff --git a/file.txt b/file.txt
+--- a/file.txt
++++ b/file.txt
+@@ -2,5 +2,5 @@
+ two
+ three
+-four
++FOUR
+ five
+ six
+@@ -10,3 +10,3 @@
+ ten
+-eleven
++ELEVEN
+ twelve
+`
+
+	numbers := []string{"one", "two", "three", "four", "five", "six", "seven", "eight", "nine", "ten", "eleven", "twelve"}
+
+	tests := map[string]struct {
+		Src       []string
+		MaxOffset int
+		MaxFuzz   int
+		Ignore    bool
+		Matches   []FragmentMatch
+		Ignored   int
+		Conflict  bool
+	}{
+		"exact": {
+			Src:       numbers,
+			MaxOffset: 10,
+			MaxFuzz:   2,
+		},
+		"offset": {
+			Src:       append([]string{"zero", "zero"}, numbers...),
+			MaxOffset: 2,
+			Matches: []FragmentMatch{
+				{File: "file.txt", Fragment: 1, Line: 2, Offset: 2},
+				{File: "file.txt", Fragment: 2, Line: 10, Offset: 2},
+			},
+		},
+		"offsetTooLarge": {
+			Src:       append([]string{"zero", "zero", "zero"}, numbers...),
+			MaxOffset: 2,
+			Conflict:  true,
+		},
+		"negativeOffset": {
+			Src:       numbers[1:],
+			MaxOffset: 2,
+			Matches: []FragmentMatch{
+				{File: "file.txt", Fragment: 1, Line: 2, Offset: -1},
+				{File: "file.txt", Fragment: 2, Line: 10, Offset: -1},
+			},
+		},
+		"fuzz": {
+			Src:     replace(numbers, "two", "2", "twelve", "12"),
+			MaxFuzz: 1,
+			Matches: []FragmentMatch{
+				{File: "file.txt", Fragment: 1, Line: 2, Fuzz: 1},
+				{File: "file.txt", Fragment: 2, Line: 10, Fuzz: 1},
+			},
+		},
+		"fuzzTooSmall": {
+			Src:     replace(numbers, "two", "2", "three", "3"),
+			MaxFuzz: 1,
+			// Both changed lines are leading context, which needs a fuzz of 2
+			Conflict: true,
+		},
+		"offsetAndFuzz": {
+			Src:       replace(append([]string{"zero"}, numbers...), "six", "6"),
+			MaxOffset: 1,
+			MaxFuzz:   1,
+			Matches: []FragmentMatch{
+				{File: "file.txt", Fragment: 1, Line: 2, Offset: 1, Fuzz: 1},
+				{File: "file.txt", Fragment: 2, Line: 10, Offset: 1},
+			},
+		},
+		"ignoreLeadingWhitespace": {
+			Src:    replace(numbers, "five", "\tfive"),
+			Ignore: true,
+			// Leading whitespace must be present in both lines
+			Conflict: true,
+		},
+		"ignoreTrailingWhitespace": {
+			Src:     replace(numbers, "three", "three  ", "five", "five\t", "twelve", "twelve "),
+			Ignore:  true,
+			Ignored: 3,
+		},
+		"ignoreWhitespaceDisabled": {
+			Src:      replace(numbers, "three", "three  "),
+			Conflict: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			files, _, err := gitdiff.Parse(strings.NewReader(patch))
+			if err != nil {
+				t.Fatalf("unexpected error parsing patch: %v", err)
+			}
+			src := []byte(strings.Join(test.Src, "\n") + "\n")
+
+			opts := matchOptions{maxOffset: test.MaxOffset, maxFuzz: test.MaxFuzz, ignoreWhitespace: test.Ignore}
+			fuzzed, matches, ignored := matchFragments(src, files[0], opts)
+
+			if len(matches) != len(test.Matches) {
+				t.Fatalf("incorrect number of matches: want %d, got %d: %+v", len(test.Matches), len(matches), matches)
+			}
+			for i := range matches {
+				if matches[i] != test.Matches[i] {
+					t.Errorf("incorrect match %d:\nwant: %+v\n got: %+v", i, test.Matches[i], matches[i])
+				}
+			}
+
+			if ignored != test.Ignored {
+				t.Errorf("incorrect ignored context lines: want %d, got %d", test.Ignored, ignored)
+			}
+
+			var b bytes.Buffer
+			err = apply(&b, bytes.NewReader(src), "file.txt", fuzzed)
+			if test.Conflict {
+				if err == nil {
+					t.Fatal("expected conflict applying patch, but got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error applying patch: %v", err)
+			}
+
+			want := string(src)
+			want = strings.Replace(want, "four\n", "FOUR\n", 1)
+			want = strings.Replace(want, "eleven\n", "ELEVEN\n", 1)
+			if got := b.String(); got != want {
+				t.Errorf("incorrect result:\nwant:\n%s\n got:\n%s", want, got)
+			}
+		})
+	}
+}
+
+func replace(lines []string, oldnew ...string) []string {
+	replaced := make([]string, len(lines))
+	copy(replaced, lines)
+	for i, line := range replaced {
+		for j := 0; j < len(oldnew); j += 2 {
+			if line == oldnew[j] {
+				replaced[i] = oldnew[j+1]
+			}
+		}
+	}
+	return replaced
+}
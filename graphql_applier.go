@@ -8,6 +8,11 @@ import (
 	"io"
 	"os"
 	"path"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"unicode/utf8"
 
 	"github.com/bluekeyes/go-gitdiff/gitdiff"
 	"github.com/google/go-github/v89/github"
@@ -41,6 +46,18 @@ type GraphQLApplier struct {
 	commit    string
 	changes   map[string]pendingChange
 	modeCache map[string]os.FileMode
+	attrCache map[string]*gitAttributes
+
+	maxCommitBytes int
+	splitCommits   bool
+
+	coAuthorAuthor    bool
+	coAuthorCommitter bool
+
+	match      matchOptions
+	whitespace WhitespaceMode
+	matches    []FragmentMatch
+	reports    []WhitespaceReport
 }
 
 type pendingChange struct {
@@ -67,14 +84,66 @@ func (a *GraphQLApplier) SetV3Client(client *github.Client) {
 	a.v3client = client
 }
 
+// SetMaxCommitBytes sets the approximate maximum size in bytes of the request
+// payload for a single commit. The size includes the base64-encoded content of
+// all added or modified files, the paths of all changed files, and the commit
+// message. A value of zero or less removes the limit.
+//
+// If split is true, Commit divides pending changes that exceed the limit into
+// multiple sequential commits. Otherwise, Commit returns a
+// *PayloadTooLargeError without modifying the repository.
+func (a *GraphQLApplier) SetMaxCommitBytes(limit int, split bool) {
+	a.maxCommitBytes = limit
+	a.splitCommits = split
+}
+
+// SetCoAuthorTrailers configures Commit to append "Co-authored-by:" trailers
+// to the commit message for the author and optionally the committer in the
+// patch header. Because GitHub always sets the author and committer of the
+// commit, this preserves attribution for the original authors of the patch.
+// Identities without an email address and identities that already appear in
+// a trailer in the message are skipped.
+func (a *GraphQLApplier) SetCoAuthorTrailers(author, committer bool) {
+	a.coAuthorAuthor = author
+	a.coAuthorCommitter = committer
+}
+
+// SetFuzz enables fuzzy matching of text fragments in modified files. It
+// works the same way as [Applier.SetFuzz].
+func (a *GraphQLApplier) SetFuzz(maxOffset, maxFuzz int) {
+	a.match.maxOffset, a.match.maxFuzz = maxOffset, maxFuzz
+}
+
+// SetWhitespace sets how Apply handles whitespace. It works the same way as
+// [Applier.SetWhitespace].
+func (a *GraphQLApplier) SetWhitespace(mode WhitespaceMode, ignoreContext bool) {
+	a.whitespace = mode
+	a.match.ignoreWhitespace = ignoreContext
+}
+
+// FragmentMatches returns the text fragments applied since the last call to
+// Commit or Reset that applied at a different line or with less context than
+// in the patch.
+func (a *GraphQLApplier) FragmentMatches() []FragmentMatch {
+	return a.matches
+}
+
+// WhitespaceReports returns a report for each file applied since the last call
+// to Commit or Reset that had whitespace errors or ignored whitespace.
+func (a *GraphQLApplier) WhitespaceReports() []WhitespaceReport {
+	return a.reports
+}
+
 // Apply applies the changes in a file, adding the result to the list of
-// pending file changes. It does not modify the repository.
+// pending file changes. It does not modify the repository. Apply handles line
+// endings in the same way as [Applier.Apply].
 //
 // Due to GraphQL limitations, some patches are not supported:
 //
 //   - Adding or renaming files that use a non-standard mode
 //   - Changing the mode of an existing file
 //   - Modifying or deleting binary files (without a V3 client)
+//   - Modifying or deleting files that are not valid UTF-8 (without a V3 client)
 //   - Modifying or deleting large files (without a V3 client)
 //
 // When given an unsupported patch, Apply returns an error such that
@@ -127,12 +196,23 @@ func (a *GraphQLApplier) applyCreate(ctx context.Context, f *gitdiff.File) error
 		return &Conflict{Type: ConflictNewFileExists, File: f.NewName}
 	}
 
-	var b bytes.Buffer
-	if err := apply(&b, bytes.NewReader(nil), f.NewName, f); err != nil {
+	eol, err := detectLineEnding(ctx, f.NewName, nil, f, a.readAttributes)
+	if err != nil {
+		return err
+	}
+
+	adjusted, err := adjustFile(nil, f, f.NewName, eol, a.match, a.whitespace)
+	if err != nil {
 		return err
 	}
 
-	a.changes[f.NewName] = pendingChange{Content: b.Bytes()}
+	data, err := adjusted.apply(f.NewName)
+	if err != nil {
+		return err
+	}
+	a.addReport(adjusted.report)
+
+	a.changes[f.NewName] = pendingChange{Content: data}
 	a.modeCache[f.NewName] = defaultMode
 	return nil
 }
@@ -148,6 +228,12 @@ func (a *GraphQLApplier) applyDelete(ctx context.Context, f *gitdiff.File) error
 		return &Conflict{Type: ConflictDeletedFileMissing, File: f.OldName}
 	}
 
+	eol, err := detectLineEnding(ctx, f.OldName, data, f, a.readAttributes)
+	if err != nil {
+		return err
+	}
+
+	data, f = normalizeLineEndings(data, f, eol)
 	if err := apply(io.Discard, bytes.NewReader(data), f.OldName, f); err != nil {
 		return err
 	}
@@ -166,11 +252,21 @@ func (a *GraphQLApplier) applyModify(ctx context.Context, f *gitdiff.File) error
 	}
 
 	if len(f.TextFragments) > 0 || f.BinaryFragment != nil {
-		var b bytes.Buffer
-		if err := apply(&b, bytes.NewReader(data), f.OldName, f); err != nil {
+		eol, err := detectLineEnding(ctx, f.NewName, data, f, a.readAttributes)
+		if err != nil {
 			return err
 		}
-		data = b.Bytes()
+
+		adjusted, err := adjustFile(data, f, f.OldName, eol, a.match, a.whitespace)
+		if err != nil {
+			return err
+		}
+
+		if data, err = adjusted.apply(f.OldName); err != nil {
+			return err
+		}
+		a.matches = append(a.matches, adjusted.matches...)
+		a.addReport(adjusted.report)
 	}
 
 	// delete the old file if it was removed
@@ -196,6 +292,8 @@ func (a *GraphQLApplier) getContent(ctx context.Context, filePath string) ([]byt
 			Object struct {
 				Blob struct {
 					OID         string
+					ByteSize    int
+					IsBinary    *bool
 					IsTruncated bool
 					Text        *string
 				} `graphql:"... on Blob"`
@@ -216,14 +314,14 @@ func (a *GraphQLApplier) getContent(ctx context.Context, filePath string) ([]byt
 	if blob.OID == "" {
 		return nil, false, nil
 	}
-	if !blob.IsTruncated && blob.Text != nil {
+	if isTextBlob(blob.ByteSize, blob.IsBinary, blob.IsTruncated, blob.Text) {
 		return []byte(*blob.Text), true, nil
 	}
 
-	// Either the file is binary or is too big for GraphQL, so fall back to the
-	// REST API if a client is available
+	// Either the file is binary, is not valid UTF-8, or is too big for
+	// GraphQL, so fall back to the REST API if a client is available
 	if a.v3client == nil {
-		return nil, true, unsupported("GraphQL cannot read the file content and there is no fallback v3 client")
+		return nil, true, unsupported("GraphQL cannot read the content of %s and there is no fallback v3 client", filePath)
 	}
 
 	b, _, err := a.v3client.Git.GetBlobRaw(ctx, a.owner, a.repo, blob.OID)
@@ -233,6 +331,46 @@ func (a *GraphQLApplier) getContent(ctx context.Context, filePath string) ([]byt
 	return b, true, nil
 }
 
+// readAttributes reads and parses the .gitattributes file at filePath. It
+// caches parsed files from the base commit, including missing files, but not
+// files with pending changes.
+func (a *GraphQLApplier) readAttributes(ctx context.Context, filePath string) (*gitAttributes, error) {
+	if attrs, ok := a.attrCache[filePath]; ok {
+		return attrs, nil
+	}
+
+	data, exists, err := a.getContent(ctx, filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	var attrs *gitAttributes
+	if exists {
+		attrs = parseGitAttributes(data)
+	}
+	if _, ok := a.changes[filePath]; !ok {
+		a.attrCache[filePath] = attrs
+	}
+	return attrs, nil
+}
+
+// isTextBlob returns true if the text of a blob returned by the GraphQL API is
+// an exact representation of the blob content. GitHub returns text for some
+// binary files and replaces invalid UTF-8 sequences, so the text is only safe
+// to use if the blob is not binary, not truncated, valid UTF-8, and the same
+// size as the blob.
+func isTextBlob(size int, isBinary *bool, isTruncated bool, text *string) bool {
+	switch {
+	case text == nil || isBinary == nil:
+		return false
+	case *isBinary || isTruncated:
+		return false
+	case len(*text) != size:
+		return false
+	}
+	return utf8.ValidString(*text)
+}
+
 func (a *GraphQLApplier) getMode(ctx context.Context, filePath string) (os.FileMode, error) {
 	if m, ok := a.modeCache[filePath]; ok {
 		return m, nil
@@ -280,33 +418,99 @@ func (a *GraphQLApplier) getMode(ctx context.Context, filePath string) (os.FileM
 //
 // If header is not nil, Apply uses it to set the commit message. It ignores
 // other fields set in header. In particular, the commit timestamp, author, and
-// committer are always set by GitHub.
+// committer are always set by GitHub. Use SetCoAuthorTrailers to add the
+// author and committer from header to the message as trailers.
+//
+// If the pending changes exceed the limit set by SetMaxCommitBytes and
+// splitting is enabled, Commit creates multiple commits, appending "(part
+// N/M)" to the title of each one, and returns the OID of the last commit. If a
+// later commit fails, the changes in earlier commits remain on the branch and
+// are no longer pending.
 func (a *GraphQLApplier) Commit(ctx context.Context, ref string, header *gitdiff.PatchHeader) (string, error) {
 	if len(a.changes) == 0 {
 		return "", fmt.Errorf("no pending file changes")
 	}
 
-	var m struct {
-		CreateCommitOnBranch struct {
-			Commit struct {
-				OID string
+	parts, err := a.splitChanges(header)
+	if err != nil {
+		return "", err
+	}
+
+	for i, paths := range parts {
+		var m struct {
+			CreateCommitOnBranch struct {
+				Commit struct {
+					OID string
+				}
+			} `graphql:"createCommitOnBranch(input: $input)"`
+		}
+
+		input := a.makeInput(ref, a.makeMessage(header, i+1, len(parts)), paths)
+		if err := a.v4client.Mutate(ctx, &m, input, nil); err != nil {
+			if len(parts) > 1 {
+				return "", fmt.Errorf("commit failed: part %d/%d: %w", i+1, len(parts), err)
 			}
-		} `graphql:"createCommitOnBranch(input: $input)"`
+			return "", fmt.Errorf("commit failed: %w", err)
+		}
+
+		a.commit = m.CreateCommitOnBranch.Commit.OID
+		for _, path := range paths {
+			delete(a.changes, path)
+		}
 	}
 
-	input := a.makeInput(ref, header)
-	if err := a.v4client.Mutate(ctx, &m, input, nil); err != nil {
-		return "", fmt.Errorf("commit failed: %w", err)
+	a.matches = nil
+	a.reports = nil
+	return a.commit, nil
+}
+
+// splitChanges groups the paths of all pending changes into one or more
+// commits that respect the maximum commit size.
+func (a *GraphQLApplier) splitChanges(header *gitdiff.PatchHeader) ([][]string, error) {
+	paths := make([]string, 0, len(a.changes))
+	for path := range a.changes {
+		paths = append(paths, path)
 	}
+	sort.Strings(paths)
 
-	oid := m.CreateCommitOnBranch.Commit.OID
-	a.commit = oid
-	a.changes = make(map[string]pendingChange)
+	if a.maxCommitBytes <= 0 {
+		return [][]string{paths}, nil
+	}
+
+	// Reserve space for the message, assuming the largest possible part suffix
+	msg := a.makeMessage(header, len(paths), len(paths))
+	budget := a.maxCommitBytes - messageSize(msg)
+
+	total := 0
+	for _, path := range paths {
+		total += changeSize(path, a.changes[path])
+	}
+	if total <= budget {
+		return [][]string{paths}, nil
+	}
+	if !a.splitCommits {
+		return nil, &PayloadTooLargeError{Size: total + messageSize(msg), Limit: a.maxCommitBytes}
+	}
 
-	return oid, nil
+	var parts [][]string
+	var part []string
+	var size int
+	for _, path := range paths {
+		n := changeSize(path, a.changes[path])
+		if n > budget {
+			return nil, &PayloadTooLargeError{Size: n, Limit: a.maxCommitBytes, File: path}
+		}
+		if size+n > budget {
+			parts = append(parts, part)
+			part, size = nil, 0
+		}
+		part = append(part, path)
+		size += n
+	}
+	return append(parts, part), nil
 }
 
-func (a *GraphQLApplier) makeInput(ref string, header *gitdiff.PatchHeader) githubv4.CreateCommitOnBranchInput {
+func (a *GraphQLApplier) makeInput(ref string, msg githubv4.CommitMessage, paths []string) githubv4.CreateCommitOnBranchInput {
 	branch := githubv4.String(ref)
 	repoNameWithOwner := githubv4.String(fmt.Sprintf("%s/%s", a.owner, a.repo))
 
@@ -316,24 +520,14 @@ func (a *GraphQLApplier) makeInput(ref string, header *gitdiff.PatchHeader) gith
 			RepositoryNameWithOwner: &repoNameWithOwner,
 		},
 		ExpectedHeadOid: githubv4.GitObjectID(a.commit),
-		Message: githubv4.CommitMessage{
-			Headline: githubv4.String(DefaultCommitMessage),
-		},
-		FileChanges: &githubv4.FileChanges{},
-	}
-
-	if header != nil {
-		input.Message.Headline = githubv4.String(header.Title)
-		if header.Body != "" {
-			body := githubv4.String(header.Body)
-			input.Message.Body = &body
-		}
+		Message:         msg,
+		FileChanges:     &githubv4.FileChanges{},
 	}
 
 	var dels []githubv4.FileDeletion
 	var adds []githubv4.FileAddition
-	for path, change := range a.changes {
-		switch {
+	for _, path := range paths {
+		switch change := a.changes[path]; {
 		case change.IsDelete:
 			dels = append(dels, githubv4.FileDeletion{
 				Path: githubv4.String(path),
@@ -356,12 +550,147 @@ func (a *GraphQLApplier) makeInput(ref string, header *gitdiff.PatchHeader) gith
 	return input
 }
 
+// makeMessage creates the commit message for part n of a commit split in to
+// the given number of parts.
+func (a *GraphQLApplier) makeMessage(header *gitdiff.PatchHeader, n, parts int) githubv4.CommitMessage {
+	headline := DefaultCommitMessage
+	var body string
+	if header != nil {
+		headline = header.Title
+		body = header.Body
+
+		var ids []*gitdiff.PatchIdentity
+		if a.coAuthorAuthor {
+			ids = append(ids, header.Author)
+		}
+		if a.coAuthorCommitter {
+			ids = append(ids, header.Committer)
+		}
+		body = appendCoAuthors(body, ids...)
+	}
+	if parts > 1 {
+		headline = fmt.Sprintf("%s (part %d/%d)", headline, n, parts)
+	}
+
+	msg := githubv4.CommitMessage{
+		Headline: githubv4.String(headline),
+	}
+	if body != "" {
+		msg.Body = github.Ptr(githubv4.String(body))
+	}
+	return msg
+}
+
+// appendCoAuthors appends a "Co-authored-by:" trailer to body for each
+// identity that has an email address and does not already have a trailer.
+func appendCoAuthors(body string, ids ...*gitdiff.PatchIdentity) string {
+	var trailers []string
+	for _, id := range ids {
+		if id == nil || id.Email == "" {
+			continue
+		}
+
+		trailer := "Co-authored-by: " + id.String()
+		if slices.Contains(trailers, trailer) || containsLine(body, trailer) {
+			continue
+		}
+		trailers = append(trailers, trailer)
+	}
+	if len(trailers) == 0 {
+		return body
+	}
+
+	// Add to the existing trailer block if the last paragraph looks like one
+	var sep string
+	switch {
+	case body == "":
+	case isTrailerBlock(lastParagraph(body)):
+		sep = "\n"
+	default:
+		sep = "\n\n"
+	}
+	return strings.TrimRight(body, "\n") + sep + strings.Join(trailers, "\n")
+}
+
+func containsLine(s, line string) bool {
+	for l := range strings.Lines(s) {
+		if strings.TrimSpace(l) == line {
+			return true
+		}
+	}
+	return false
+}
+
+func lastParagraph(s string) string {
+	s = strings.TrimRight(s, "\n")
+	if i := strings.LastIndex(s, "\n\n"); i >= 0 {
+		return s[i+2:]
+	}
+	return s
+}
+
+// knownTrailers are trailer keys that do not end in "-by" but are common
+// enough to identify a trailer block.
+var knownTrailers = map[string]bool{
+	"bug":       true,
+	"cc":        true,
+	"change-id": true,
+	"closes":    true,
+	"fixes":     true,
+	"link":      true,
+	"refs":      true,
+}
+
+// trailerKeyRegexp matches the key of a "Key: value" trailer.
+var trailerKeyRegexp = regexp.MustCompile(`^[A-Za-z0-9-]+$`)
+
+// isTrailerBlock returns true if every line in s looks like a "Key: value"
+// trailer and at least one key is a "*-by" key, like "Signed-off-by", or is
+// in knownTrailers. This keeps paragraphs like "Note: this fixes a crash" from
+// counting as trailers.
+func isTrailerBlock(s string) bool {
+	var known bool
+	for l := range strings.Lines(s) {
+		key, _, ok := strings.Cut(strings.TrimRight(l, "\r\n"), ": ")
+		if !ok || !trailerKeyRegexp.MatchString(key) {
+			return false
+		}
+		key = strings.ToLower(key)
+		known = known || strings.HasSuffix(key, "-by") || knownTrailers[key]
+	}
+	return known
+}
+
+func messageSize(msg githubv4.CommitMessage) int {
+	n := len(msg.Headline)
+	if msg.Body != nil {
+		n += len(*msg.Body)
+	}
+	return n
+}
+
+func changeSize(path string, c pendingChange) int {
+	if c.IsDelete {
+		return len(path)
+	}
+	return len(path) + base64.StdEncoding.EncodedLen(len(c.Content))
+}
+
 // Reset resets the applier so that future Apply calls start from commit base.
 // It removes all pending file changes. Reset does not modify the repository.
 func (a *GraphQLApplier) Reset(base string) {
 	a.commit = base
 	a.changes = make(map[string]pendingChange)
 	a.modeCache = make(map[string]os.FileMode)
+	a.attrCache = make(map[string]*gitAttributes)
+	a.matches = nil
+	a.reports = nil
+}
+
+func (a *GraphQLApplier) addReport(r WhitespaceReport) {
+	if !r.isEmpty() {
+		a.reports = append(a.reports, r)
+	}
 }
 
 func isModeChange(m1, m2 os.FileMode) bool {
@@ -1,12 +1,17 @@
 package patch2pr
 
 import (
+	"bytes"
+	"errors"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
 
 	"github.com/bluekeyes/go-gitdiff/gitdiff"
+	"github.com/google/go-github/v89/github"
+	"github.com/shurcooL/githubv4"
 )
 
 // GraphQLUnsupportedPatches contains the names of patches that cannot be applied
@@ -92,3 +97,173 @@ func runGraphQLPatchTest(t *testing.T, tctx *TestContext, name string) {
 
 	assertPatchResult(t, tctx, name, commit)
 }
+
+func TestGraphQLApplierSplitChanges(t *testing.T) {
+	changes := map[string]pendingChange{
+		"a.txt": {Content: bytes.Repeat([]byte("a"), 30)},
+		"b.txt": {Content: bytes.Repeat([]byte("b"), 30)},
+		"c.txt": {IsDelete: true},
+		"d.txt": {Content: bytes.Repeat([]byte("d"), 60)},
+	}
+	header := &gitdiff.PatchHeader{Title: "title"}
+
+	tests := map[string]struct {
+		Limit int
+		Split bool
+		Parts [][]string
+		Err   *PayloadTooLargeError
+	}{
+		"noLimit": {
+			Parts: [][]string{{"a.txt", "b.txt", "c.txt", "d.txt"}},
+		},
+		"underLimit": {
+			Limit: 1000,
+			Parts: [][]string{{"a.txt", "b.txt", "c.txt", "d.txt"}},
+		},
+		"overLimit": {
+			Limit: 150,
+			Err:   &PayloadTooLargeError{Size: 196, Limit: 150},
+		},
+		"split": {
+			Limit: 150,
+			Split: true,
+			Parts: [][]string{{"a.txt", "b.txt", "c.txt"}, {"d.txt"}},
+		},
+		"fileOverLimit": {
+			Limit: 90,
+			Split: true,
+			Err:   &PayloadTooLargeError{Size: 85, Limit: 90, File: "d.txt"},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			a := &GraphQLApplier{changes: changes}
+			a.SetMaxCommitBytes(test.Limit, test.Split)
+
+			parts, err := a.splitChanges(header)
+			if test.Err != nil {
+				var perr *PayloadTooLargeError
+				if !errors.As(err, &perr) {
+					t.Fatalf("expected PayloadTooLargeError, got %v", err)
+				}
+				if *perr != *test.Err {
+					t.Fatalf("incorrect error: expected %+v, got %+v", *test.Err, *perr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(test.Parts, parts) {
+				t.Errorf("incorrect parts:\nexpected: %v\n  actual: %v", test.Parts, parts)
+			}
+		})
+	}
+}
+
+func TestMakeMessage(t *testing.T) {
+	header := &gitdiff.PatchHeader{Title: "title", Body: "body"}
+
+	a := &GraphQLApplier{}
+
+	msg := a.makeMessage(header, 2, 3)
+	if msg.Headline != "title (part 2/3)" {
+		t.Errorf("incorrect headline: %q", msg.Headline)
+	}
+	if msg.Body == nil || *msg.Body != "body" {
+		t.Errorf("incorrect body: %v", msg.Body)
+	}
+
+	msg = a.makeMessage(nil, 1, 1)
+	if msg.Headline != githubv4.String(DefaultCommitMessage) {
+		t.Errorf("incorrect headline: %q", msg.Headline)
+	}
+	if msg.Body != nil {
+		t.Errorf("unexpected body: %q", *msg.Body)
+	}
+}
+
+func TestAppendCoAuthors(t *testing.T) {
+	author := &gitdiff.PatchIdentity{Name: "Author", Email: "author@example.com"}
+	committer := &gitdiff.PatchIdentity{Name: "Committer", Email: "committer@example.com"}
+
+	tests := map[string]struct {
+		Body     string
+		IDs      []*gitdiff.PatchIdentity
+		Expected string
+	}{
+		"emptyBody": {
+			IDs:      []*gitdiff.PatchIdentity{author},
+			Expected: "Co-authored-by: Author <author@example.com>",
+		},
+		"body": {
+			Body:     "Some details.\n",
+			IDs:      []*gitdiff.PatchIdentity{author, committer},
+			Expected: "Some details.\n\nCo-authored-by: Author <author@example.com>\nCo-authored-by: Committer <committer@example.com>",
+		},
+		"existingTrailers": {
+			Body:     "Some details.\n\nSigned-off-by: Author <author@example.com>",
+			IDs:      []*gitdiff.PatchIdentity{author},
+			Expected: "Some details.\n\nSigned-off-by: Author <author@example.com>\nCo-authored-by: Author <author@example.com>",
+		},
+		"knownTrailer": {
+			Body:     "Some details.\n\nChange-Id: I1234\nLink: https://example.com",
+			IDs:      []*gitdiff.PatchIdentity{author},
+			Expected: "Some details.\n\nChange-Id: I1234\nLink: https://example.com\nCo-authored-by: Author <author@example.com>",
+		},
+		"notTrailers": {
+			Body:     "Some details.\n\nNote: this fixes a crash on startup",
+			IDs:      []*gitdiff.PatchIdentity{author},
+			Expected: "Some details.\n\nNote: this fixes a crash on startup\n\nCo-authored-by: Author <author@example.com>",
+		},
+		"duplicate": {
+			Body:     "Co-authored-by: Author <author@example.com>",
+			IDs:      []*gitdiff.PatchIdentity{author, author},
+			Expected: "Co-authored-by: Author <author@example.com>",
+		},
+		"missingEmail": {
+			Body:     "Some details.",
+			IDs:      []*gitdiff.PatchIdentity{nil, {Name: "No Email"}},
+			Expected: "Some details.",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := appendCoAuthors(test.Body, test.IDs...); got != test.Expected {
+				t.Errorf("incorrect body:\nexpected: %q\n  actual: %q", test.Expected, got)
+			}
+		})
+	}
+}
+
+func TestIsTextBlob(t *testing.T) {
+	str := func(s string) *string { return &s }
+	yes, no := github.Ptr(true), github.Ptr(false)
+
+	tests := map[string]struct {
+		Size      int
+		Binary    *bool
+		Truncated bool
+		Text      *string
+		Expected  bool
+	}{
+		"text":          {Size: 5, Binary: no, Text: str("hello"), Expected: true},
+		"multibyte":     {Size: 6, Binary: no, Text: str("héllo"), Expected: true},
+		"noText":        {Size: 5, Binary: no, Expected: false},
+		"binary":        {Size: 5, Binary: yes, Text: str("hello"), Expected: false},
+		"unknownBinary": {Size: 5, Text: str("hello"), Expected: false},
+		"truncated":     {Size: 5, Binary: no, Truncated: true, Text: str("hello"), Expected: false},
+		"sizeMismatch":  {Size: 4, Binary: no, Text: str("h\uFFFDo"), Expected: false},
+		"invalidUTF8":   {Size: 3, Binary: no, Text: str("h\xffo"), Expected: false},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := isTextBlob(test.Size, test.Binary, test.Truncated, test.Text); got != test.Expected {
+				t.Errorf("incorrect result: expected %t, got %t", test.Expected, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,322 @@
+package patch2pr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/shurcooL/githubv4"
+)
+
+// PullRequest is a pull request created or found using the GraphQL API.
+type PullRequest struct {
+	// The GraphQL node ID of the pull request.
+	ID     string
+	Number int
+	URL    string
+
+	Title   string
+	Body    string
+	IsDraft bool
+
+	BaseRefName string
+	HeadRefName string
+	HeadRefOID  string
+}
+
+// PullRequestSpec contains the values used to create or update a pull
+// request.
+type PullRequestSpec struct {
+	Title string
+	Body  string
+	Draft bool
+
+	// The name of the branch to merge changes in to.
+	Base string
+
+	// UpdateTitle, UpdateBody, UpdateDraft, and UpdateBase select the values
+	// that Update changes in an existing pull request. Update does not change
+	// other values, so edits made on GitHub are kept.
+	UpdateTitle bool
+	UpdateBody  bool
+	UpdateDraft bool
+	UpdateBase  bool
+}
+
+// GraphQLPullRequests creates and updates pull requests in a repository using
+// the GraphQL API. Compared to the PullRequest method of Reference, it can
+// update an existing open pull request for a head branch instead of failing.
+type GraphQLPullRequests struct {
+	client *githubv4.Client
+	owner  string
+	repo   string
+}
+
+// NewGraphQLPullRequests creates a new GraphQLPullRequests for pull requests
+// that target repo.
+func NewGraphQLPullRequests(client *githubv4.Client, repo Repository) *GraphQLPullRequests {
+	return &GraphQLPullRequests{
+		client: client,
+		owner:  repo.Owner,
+		repo:   repo.Name,
+	}
+}
+
+type pullRequestFields struct {
+	ID          string
+	Number      int
+	URL         string
+	Title       string
+	Body        string
+	IsDraft     bool
+	BaseRefName string
+	HeadRefName string
+	HeadRefOID  string
+
+	HeadRepository *struct {
+		Name  string
+		Owner struct {
+			Login string
+		}
+	}
+}
+
+func (f pullRequestFields) toPullRequest() *PullRequest {
+	return &PullRequest{
+		ID:          f.ID,
+		Number:      f.Number,
+		URL:         f.URL,
+		Title:       f.Title,
+		Body:        f.Body,
+		IsDraft:     f.IsDraft,
+		BaseRefName: f.BaseRefName,
+		HeadRefName: f.HeadRefName,
+		HeadRefOID:  f.HeadRefOID,
+	}
+}
+
+// Find returns the open pull request with the branch in head as its head
+// branch. It returns nil if there is no open pull request for the branch.
+func (p *GraphQLPullRequests) Find(ctx context.Context, head Repository, branch string) (*PullRequest, error) {
+	var q struct {
+		Repository struct {
+			PullRequests struct {
+				Nodes []pullRequestFields
+			} `graphql:"pullRequests(headRefName: $branch, states: [OPEN], first: 100)"`
+		} `graphql:"repository(owner: $owner, name: $name)"`
+	}
+	vars := map[string]any{
+		"owner":  githubv4.String(p.owner),
+		"name":   githubv4.String(p.repo),
+		"branch": githubv4.String(branch),
+	}
+
+	if err := p.client.Query(ctx, &q, vars); err != nil {
+		return nil, fmt.Errorf("pull request query failed: %w", err)
+	}
+
+	for _, pr := range q.Repository.PullRequests.Nodes {
+		if hr := pr.HeadRepository; hr != nil && hr.Owner.Login == head.Owner && hr.Name == head.Name {
+			return pr.toPullRequest(), nil
+		}
+	}
+	return nil, nil
+}
+
+// Create creates a new pull request for the branch in head using the values
+// in spec. If head is a different repository, it must be a fork of the target
+// repository.
+func (p *GraphQLPullRequests) Create(ctx context.Context, head Repository, branch string, spec PullRequestSpec) (*PullRequest, error) {
+	if spec.Base == "" {
+		return nil, errors.New("pull request spec is missing a base branch")
+	}
+
+	repoID, err := p.repositoryID(ctx, Repository{Owner: p.owner, Name: p.repo})
+	if err != nil {
+		return nil, err
+	}
+
+	input := githubv4.CreatePullRequestInput{
+		RepositoryID: repoID,
+		BaseRefName:  githubv4.String(spec.Base),
+		Title:        githubv4.String(spec.Title),
+		Body:         githubv4.NewString(githubv4.String(spec.Body)),
+		Draft:        githubv4.NewBoolean(githubv4.Boolean(spec.Draft)),
+	}
+	if head.Owner == p.owner && head.Name == p.repo {
+		input.HeadRefName = githubv4.String(branch)
+	} else {
+		headID, err := p.repositoryID(ctx, head)
+		if err != nil {
+			return nil, err
+		}
+		input.HeadRefName = githubv4.String(fmt.Sprintf("%s:%s", head.Owner, branch))
+		input.HeadRepositoryID = &headID
+	}
+
+	var m struct {
+		CreatePullRequest struct {
+			PullRequest pullRequestFields
+		} `graphql:"createPullRequest(input: $input)"`
+	}
+	if err := p.client.Mutate(ctx, &m, input, nil); err != nil {
+		return nil, fmt.Errorf("create pull request failed: %w", err)
+	}
+	return m.CreatePullRequest.PullRequest.toPullRequest(), nil
+}
+
+// Update sets the values of an existing pull request selected by the Update
+// fields of spec. If spec does not select any values that differ from pr,
+// Update returns pr without making any requests.
+func (p *GraphQLPullRequests) Update(ctx context.Context, pr *PullRequest, spec PullRequestSpec) (*PullRequest, error) {
+	input := githubv4.UpdatePullRequestInput{PullRequestID: githubv4.ID(pr.ID)}
+	changed := false
+	if spec.UpdateTitle && spec.Title != pr.Title {
+		input.Title = githubv4.NewString(githubv4.String(spec.Title))
+		changed = true
+	}
+	if spec.UpdateBody && spec.Body != pr.Body {
+		input.Body = githubv4.NewString(githubv4.String(spec.Body))
+		changed = true
+	}
+	if spec.UpdateBase && spec.Base != "" && spec.Base != pr.BaseRefName {
+		input.BaseRefName = githubv4.NewString(githubv4.String(spec.Base))
+		changed = true
+	}
+
+	current := *pr
+	updated := &current
+	if changed {
+		var m struct {
+			UpdatePullRequest struct {
+				PullRequest pullRequestFields
+			} `graphql:"updatePullRequest(input: $input)"`
+		}
+		if err := p.client.Mutate(ctx, &m, input, nil); err != nil {
+			return nil, fmt.Errorf("update pull request failed: %w", err)
+		}
+		updated = m.UpdatePullRequest.PullRequest.toPullRequest()
+	}
+
+	if spec.UpdateDraft && updated.IsDraft != spec.Draft {
+		if err := p.setDraft(ctx, updated.ID, spec.Draft); err != nil {
+			return nil, err
+		}
+		updated.IsDraft = spec.Draft
+	}
+	return updated, nil
+}
+
+// CreateOrUpdate updates the open pull request for the branch in head if one
+// exists and otherwise creates a new pull request. It returns the pull
+// request and true if the pull request was created or false if it was
+// updated.
+func (p *GraphQLPullRequests) CreateOrUpdate(ctx context.Context, head Repository, branch string, spec PullRequestSpec) (*PullRequest, bool, error) {
+	existing, err := p.Find(ctx, head, branch)
+	if err != nil {
+		return nil, false, err
+	}
+	if existing != nil {
+		pr, err := p.Update(ctx, existing, spec)
+		return pr, false, err
+	}
+
+	pr, err := p.Create(ctx, head, branch, spec)
+	return pr, true, err
+}
+
+// Close closes a pull request without merging it.
+func (p *GraphQLPullRequests) Close(ctx context.Context, pr *PullRequest) error {
+	var m struct {
+		ClosePullRequest struct {
+			ClientMutationID *string
+		} `graphql:"closePullRequest(input: $input)"`
+	}
+	input := githubv4.ClosePullRequestInput{PullRequestID: githubv4.ID(pr.ID)}
+	if err := p.client.Mutate(ctx, &m, input, nil); err != nil {
+		return fmt.Errorf("close pull request failed: %w", err)
+	}
+	return nil
+}
+
+// EnableAutoMerge enables auto-merge for a pull request using the given merge
+// method, so that GitHub merges the pull request once all requirements are
+// met. If the repository does not allow auto-merge, EnableAutoMerge returns an
+// error such that IsUnsupported(err) is true.
+func (p *GraphQLPullRequests) EnableAutoMerge(ctx context.Context, pr *PullRequest, method githubv4.PullRequestMergeMethod) error {
+	var q struct {
+		Repository struct {
+			AutoMergeAllowed bool
+		} `graphql:"repository(owner: $owner, name: $name)"`
+	}
+	vars := map[string]any{
+		"owner": githubv4.String(p.owner),
+		"name":  githubv4.String(p.repo),
+	}
+	if err := p.client.Query(ctx, &q, vars); err != nil {
+		return fmt.Errorf("repository query failed: %w", err)
+	}
+	if !q.Repository.AutoMergeAllowed {
+		return unsupported("repository %s/%s does not allow auto-merge", p.owner, p.repo)
+	}
+
+	var m struct {
+		EnablePullRequestAutoMerge struct {
+			ClientMutationID *string
+		} `graphql:"enablePullRequestAutoMerge(input: $input)"`
+	}
+	input := githubv4.EnablePullRequestAutoMergeInput{
+		PullRequestID: githubv4.ID(pr.ID),
+		MergeMethod:   &method,
+	}
+	if pr.HeadRefOID != "" {
+		input.ExpectedHeadOid = githubv4.NewGitObjectID(githubv4.GitObjectID(pr.HeadRefOID))
+	}
+	if err := p.client.Mutate(ctx, &m, input, nil); err != nil {
+		return fmt.Errorf("enable auto-merge failed: %w", err)
+	}
+	return nil
+}
+
+func (p *GraphQLPullRequests) setDraft(ctx context.Context, id string, draft bool) error {
+	if draft {
+		var m struct {
+			ConvertPullRequestToDraft struct {
+				ClientMutationID *string
+			} `graphql:"convertPullRequestToDraft(input: $input)"`
+		}
+		input := githubv4.ConvertPullRequestToDraftInput{PullRequestID: githubv4.ID(id)}
+		if err := p.client.Mutate(ctx, &m, input, nil); err != nil {
+			return fmt.Errorf("convert pull request to draft failed: %w", err)
+		}
+		return nil
+	}
+
+	var m struct {
+		MarkPullRequestReadyForReview struct {
+			ClientMutationID *string
+		} `graphql:"markPullRequestReadyForReview(input: $input)"`
+	}
+	input := githubv4.MarkPullRequestReadyForReviewInput{PullRequestID: githubv4.ID(id)}
+	if err := p.client.Mutate(ctx, &m, input, nil); err != nil {
+		return fmt.Errorf("mark pull request ready for review failed: %w", err)
+	}
+	return nil
+}
+
+func (p *GraphQLPullRequests) repositoryID(ctx context.Context, repo Repository) (githubv4.ID, error) {
+	var q struct {
+		Repository struct {
+			ID string
+		} `graphql:"repository(owner: $owner, name: $name)"`
+	}
+	vars := map[string]any{
+		"owner": githubv4.String(repo.Owner),
+		"name":  githubv4.String(repo.Name),
+	}
+
+	if err := p.client.Query(ctx, &q, vars); err != nil {
+		return nil, fmt.Errorf("repository query for %s failed: %w", repo, err)
+	}
+	return githubv4.ID(q.Repository.ID), nil
+}
@@ -0,0 +1,342 @@
+package patch2pr
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/shurcooL/githubv4"
+)
+
+func TestGraphQLPullRequestsUpdate(t *testing.T) {
+	pr := &PullRequest{
+		ID:          "PR_1",
+		Number:      1,
+		Title:       "Edited title",
+		Body:        "Edited body",
+		IsDraft:     true,
+		BaseRefName: "main",
+	}
+
+	tests := map[string]struct {
+		Spec      PullRequestSpec
+		Mutations []string
+		Title     string
+		IsDraft   bool
+	}{
+		"keepEdits": {
+			Spec:    PullRequestSpec{Title: "Commit title", Body: "Commit body", Base: "main"},
+			Title:   "Edited title",
+			IsDraft: true,
+		},
+		"updateTitle": {
+			Spec:      PullRequestSpec{Title: "New title", Base: "main", UpdateTitle: true},
+			Mutations: []string{"updatePullRequest"},
+			Title:     "New title",
+			IsDraft:   true,
+		},
+		"markReady": {
+			Spec:      PullRequestSpec{Title: "Commit title", Base: "main", UpdateDraft: true},
+			Mutations: []string{"markPullRequestReadyForReview"},
+			Title:     "Edited title",
+		},
+		"sameBase": {
+			Spec:    PullRequestSpec{Base: "main", UpdateBase: true},
+			Title:   "Edited title",
+			IsDraft: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			var mutations []string
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var req struct {
+					Query     string
+					Variables struct {
+						Input map[string]any
+					}
+				}
+				if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+					t.Errorf("invalid request: %v", err)
+				}
+
+				name := operationName(req.Query)
+				mutations = append(mutations, name)
+
+				if name != "updatePullRequest" {
+					fmt.Fprintf(w, `{"data": {"%s": {"clientMutationId": null}}}`, name)
+					return
+				}
+
+				title := pr.Title
+				if v, ok := req.Variables.Input["title"].(string); ok {
+					title = v
+				}
+				fmt.Fprintf(w, `{"data": {"%s": {"pullRequest": {"id": "PR_1", "number": 1, "title": %q, "isDraft": true}}}}`, name, title)
+			}))
+			defer srv.Close()
+
+			p := NewGraphQLPullRequests(githubv4.NewEnterpriseClient(srv.URL, srv.Client()), Repository{Owner: "o", Name: "r"})
+
+			updated, err := p.Update(t.Context(), pr, test.Spec)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if strings.Join(mutations, ",") != strings.Join(test.Mutations, ",") {
+				t.Errorf("incorrect mutations: want %v, got %v", test.Mutations, mutations)
+			}
+			if updated.Title != test.Title {
+				t.Errorf("incorrect title: want %q, got %q", test.Title, updated.Title)
+			}
+			if updated.IsDraft != test.IsDraft {
+				t.Errorf("incorrect draft state: want %t, got %t", test.IsDraft, updated.IsDraft)
+			}
+			if !pr.IsDraft {
+				t.Error("Update modified the input pull request")
+			}
+		})
+	}
+}
+
+func TestGraphQLPullRequestsFind(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req := decodeGraphQLRequest(t, r)
+		if req.Variables["branch"] != "feature" {
+			t.Errorf("incorrect branch: want %q, got %v", "feature", req.Variables["branch"])
+		}
+		fmt.Fprint(w, `{"data": {"repository": {"pullRequests": {"nodes": [
+			{"id": "PR_1", "number": 1, "headRefName": "feature", "headRepository": {"name": "r", "owner": {"login": "other"}}},
+			{"id": "PR_2", "number": 2, "headRefName": "feature", "headRepository": {"name": "r", "owner": {"login": "o"}}},
+			{"id": "PR_3", "number": 3, "headRefName": "feature", "headRepository": null}
+		]}}}}`)
+	}))
+	defer srv.Close()
+
+	p := NewGraphQLPullRequests(githubv4.NewEnterpriseClient(srv.URL, srv.Client()), Repository{Owner: "o", Name: "r"})
+
+	tests := map[string]struct {
+		Head   Repository
+		Number int
+	}{
+		"sameRepository":  {Head: Repository{Owner: "o", Name: "r"}, Number: 2},
+		"otherOwner":      {Head: Repository{Owner: "other", Name: "r"}, Number: 1},
+		"otherRepository": {Head: Repository{Owner: "o", Name: "fork"}},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			pr, err := p.Find(t.Context(), test.Head, "feature")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			var number int
+			if pr != nil {
+				number = pr.Number
+			}
+			if number != test.Number {
+				t.Errorf("incorrect pull request: want %d, got %d", test.Number, number)
+			}
+		})
+	}
+}
+
+func TestGraphQLPullRequestsCreate(t *testing.T) {
+	tests := map[string]struct {
+		Head             Repository
+		HeadRefName      string
+		HeadRepositoryID string
+	}{
+		"sameRepository": {
+			Head:        Repository{Owner: "o", Name: "r"},
+			HeadRefName: "feature",
+		},
+		"fork": {
+			Head:             Repository{Owner: "contributor", Name: "fork"},
+			HeadRefName:      "contributor:feature",
+			HeadRepositoryID: "R_contributor/fork",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			var input map[string]any
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				req := decodeGraphQLRequest(t, r)
+				switch name := operationName(req.Query); name {
+				case "repository":
+					fmt.Fprintf(w, `{"data": {"repository": {"id": "R_%s/%s"}}}`, req.Variables["owner"], req.Variables["name"])
+				case "createPullRequest":
+					input, _ = req.Variables["input"].(map[string]any)
+					fmt.Fprint(w, `{"data": {"createPullRequest": {"pullRequest": {"id": "PR_1", "number": 1, "title": "Title"}}}}`)
+				default:
+					t.Errorf("unexpected operation: %s", name)
+					fmt.Fprint(w, `{"errors": [{"message": "unexpected operation"}]}`)
+				}
+			}))
+			defer srv.Close()
+
+			p := NewGraphQLPullRequests(githubv4.NewEnterpriseClient(srv.URL, srv.Client()), Repository{Owner: "o", Name: "r"})
+
+			pr, err := p.Create(t.Context(), test.Head, "feature", PullRequestSpec{Title: "Title", Body: "Body", Base: "main", Draft: true})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if pr.Number != 1 {
+				t.Errorf("incorrect number: want 1, got %d", pr.Number)
+			}
+
+			want := map[string]any{
+				"repositoryId": "R_o/r",
+				"baseRefName":  "main",
+				"headRefName":  test.HeadRefName,
+				"title":        "Title",
+				"body":         "Body",
+				"draft":        true,
+			}
+			if test.HeadRepositoryID != "" {
+				want["headRepositoryId"] = test.HeadRepositoryID
+			}
+			for k, v := range want {
+				if input[k] != v {
+					t.Errorf("incorrect %s: want %v, got %v", k, v, input[k])
+				}
+			}
+			if _, ok := input["headRepositoryId"]; ok && test.HeadRepositoryID == "" {
+				t.Errorf("unexpected headRepositoryId: %v", input["headRepositoryId"])
+			}
+		})
+	}
+
+	t.Run("missingBase", func(t *testing.T) {
+		p := NewGraphQLPullRequests(githubv4.NewClient(nil), Repository{Owner: "o", Name: "r"})
+		if _, err := p.Create(t.Context(), Repository{Owner: "o", Name: "r"}, "feature", PullRequestSpec{Title: "Title"}); err == nil {
+			t.Fatal("expected error, but got nil")
+		}
+	})
+}
+
+func TestGraphQLPullRequestsCreateOrUpdate(t *testing.T) {
+	var operations []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req := decodeGraphQLRequest(t, r)
+		name := operationName(req.Query)
+		operations = append(operations, name)
+
+		switch name {
+		case "repository":
+			fmt.Fprint(w, `{"data": {"repository": {"pullRequests": {"nodes": [
+				{"id": "PR_7", "number": 7, "title": "Old title", "baseRefName": "main", "headRefName": "feature", "headRepository": {"name": "r", "owner": {"login": "o"}}}
+			]}}}}`)
+		case "updatePullRequest":
+			fmt.Fprint(w, `{"data": {"updatePullRequest": {"pullRequest": {"id": "PR_7", "number": 7, "title": "New title"}}}}`)
+		default:
+			t.Errorf("unexpected operation: %s", name)
+			fmt.Fprint(w, `{"errors": [{"message": "unexpected operation"}]}`)
+		}
+	}))
+	defer srv.Close()
+
+	p := NewGraphQLPullRequests(githubv4.NewEnterpriseClient(srv.URL, srv.Client()), Repository{Owner: "o", Name: "r"})
+
+	spec := PullRequestSpec{Title: "New title", Base: "main", UpdateTitle: true}
+	pr, created, err := p.CreateOrUpdate(t.Context(), Repository{Owner: "o", Name: "r"}, "feature", spec)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if created {
+		t.Error("expected existing pull request to be updated, but it was created")
+	}
+	if pr.Number != 7 || pr.Title != "New title" {
+		t.Errorf("incorrect pull request: want #7 %q, got #%d %q", "New title", pr.Number, pr.Title)
+	}
+	if want := "repository,updatePullRequest"; strings.Join(operations, ",") != want {
+		t.Errorf("incorrect operations: want %s, got %s", want, strings.Join(operations, ","))
+	}
+}
+
+type graphQLRequest struct {
+	Query     string
+	Variables map[string]any
+}
+
+func decodeGraphQLRequest(t *testing.T, r *http.Request) graphQLRequest {
+	var req graphQLRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		t.Errorf("invalid request: %v", err)
+	}
+	return req
+}
+
+// operationName returns the name of the first field in a query or mutation,
+// like "repository" or "updatePullRequest".
+func operationName(query string) string {
+	name := query[strings.Index(query, "{")+1:]
+	return name[:strings.Index(name, "(")]
+}
+
+func TestGraphQLPullRequestsEnableAutoMerge(t *testing.T) {
+	tests := map[string]struct {
+		Allowed     bool
+		Method      githubv4.PullRequestMergeMethod
+		Unsupported bool
+	}{
+		"squash":     {Allowed: true, Method: githubv4.PullRequestMergeMethodSquash},
+		"rebase":     {Allowed: true, Method: githubv4.PullRequestMergeMethodRebase},
+		"notAllowed": {Method: githubv4.PullRequestMergeMethodMerge, Unsupported: true},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			var input map[string]any
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				req := decodeGraphQLRequest(t, r)
+				switch name := operationName(req.Query); name {
+				case "repository":
+					fmt.Fprintf(w, `{"data": {"repository": {"autoMergeAllowed": %t}}}`, test.Allowed)
+				case "enablePullRequestAutoMerge":
+					input, _ = req.Variables["input"].(map[string]any)
+					fmt.Fprint(w, `{"data": {"enablePullRequestAutoMerge": {"clientMutationId": null}}}`)
+				default:
+					t.Errorf("unexpected operation: %s", name)
+					fmt.Fprint(w, `{"errors": [{"message": "unexpected operation"}]}`)
+				}
+			}))
+			defer srv.Close()
+
+			p := NewGraphQLPullRequests(githubv4.NewEnterpriseClient(srv.URL, srv.Client()), Repository{Owner: "o", Name: "r"})
+			pr := &PullRequest{ID: "PR_1", Number: 1, HeadRefOID: "1111111111111111111111111111111111111111"}
+
+			err := p.EnableAutoMerge(t.Context(), pr, test.Method)
+			if test.Unsupported {
+				if !IsUnsupported(err) {
+					t.Fatalf("expected unsupported error, but got %v", err)
+				}
+				if input != nil {
+					t.Errorf("enabled auto-merge even though it is not allowed: %v", input)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			want := map[string]any{
+				"pullRequestId":   "PR_1",
+				"mergeMethod":     string(test.Method),
+				"expectedHeadOid": pr.HeadRefOID,
+			}
+			for k, v := range want {
+				if input[k] != v {
+					t.Errorf("incorrect %s: want %v, got %v", k, v, input[k])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,157 @@
+package patch2pr
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/google/go-github/v89/github"
+)
+
+// PullRequestMetadata contains optional details to add to a pull request
+// after it is created.
+type PullRequestMetadata struct {
+	// Labels are the names of labels to add to the pull request.
+	Labels []string
+
+	// Reviewers are the logins of users to request reviews from.
+	Reviewers []string
+
+	// TeamReviewers are the slugs of teams to request reviews from.
+	TeamReviewers []string
+
+	// Assignees are the logins of users to assign to the pull request.
+	Assignees []string
+
+	// Milestone is the title of an open milestone or the number of a
+	// milestone to attach to the pull request. Titles take precedence, so a
+	// milestone titled "2024" is used even if it is not milestone number 2024.
+	Milestone string
+}
+
+// IsEmpty returns true if the metadata does not contain any values.
+func (md PullRequestMetadata) IsEmpty() bool {
+	return len(md.Labels) == 0 &&
+		len(md.Reviewers) == 0 &&
+		len(md.TeamReviewers) == 0 &&
+		len(md.Assignees) == 0 &&
+		md.Milestone == ""
+}
+
+// MetadataError is returned when adding some metadata to a pull request
+// fails. Other metadata may have been added successfully.
+type MetadataError struct {
+	// Failures contains the error for each type of metadata that could not be
+	// added, keyed by type: "labels", "reviewers", "assignees", or
+	// "milestone".
+	Failures map[string]error
+}
+
+func (err *MetadataError) Error() string {
+	var parts []string
+	for _, field := range metadataFields {
+		if ferr, ok := err.Failures[field]; ok {
+			parts = append(parts, fmt.Sprintf("%s: %v", field, ferr))
+		}
+	}
+	return "add pull request metadata failed: " + strings.Join(parts, "; ")
+}
+
+func (err *MetadataError) Unwrap() []error {
+	errs := make([]error, 0, len(err.Failures))
+	for _, field := range metadataFields {
+		if ferr, ok := err.Failures[field]; ok {
+			errs = append(errs, ferr)
+		}
+	}
+	return errs
+}
+
+var metadataFields = []string{"labels", "reviewers", "assignees", "milestone"}
+
+// AddPullRequestMetadata adds labels, reviewers, assignees, and a milestone to
+// the pull request with the given number in repo. It attempts to add each type
+// of metadata even if an earlier type fails. If any type fails, it returns an
+// error of type *MetadataError.
+func AddPullRequestMetadata(ctx context.Context, client *github.Client, repo Repository, number int, md PullRequestMetadata) error {
+	failures := make(map[string]error)
+
+	if len(md.Labels) > 0 {
+		if _, _, err := client.Issues.AddLabelsToIssue(ctx, repo.Owner, repo.Name, number, md.Labels); err != nil {
+			failures["labels"] = err
+		}
+	}
+
+	if len(md.Reviewers) > 0 || len(md.TeamReviewers) > 0 {
+		if _, _, err := client.PullRequests.RequestReviewers(ctx, repo.Owner, repo.Name, number, github.ReviewersRequest{
+			Reviewers:     md.Reviewers,
+			TeamReviewers: md.TeamReviewers,
+		}); err != nil {
+			failures["reviewers"] = err
+		}
+	}
+
+	if len(md.Assignees) > 0 {
+		if _, _, err := client.Issues.AddAssignees(ctx, repo.Owner, repo.Name, number, md.Assignees); err != nil {
+			failures["assignees"] = err
+		}
+	}
+
+	if md.Milestone != "" {
+		if err := setMilestone(ctx, client, repo, number, md.Milestone); err != nil {
+			failures["milestone"] = err
+		}
+	}
+
+	if len(failures) > 0 {
+		return &MetadataError{Failures: failures}
+	}
+	return nil
+}
+
+func setMilestone(ctx context.Context, client *github.Client, repo Repository, number int, milestone string) error {
+	id, found, err := findMilestone(ctx, client, repo, milestone)
+	if err != nil {
+		return err
+	}
+	if !found {
+		if id, err = strconv.Atoi(milestone); err != nil {
+			return fmt.Errorf("no open milestone with title %q", milestone)
+		}
+	}
+
+	if _, _, err := client.Issues.Edit(ctx, repo.Owner, repo.Name, number, &github.IssueRequest{
+		Milestone: &id,
+	}); err != nil {
+		return err
+	}
+	return nil
+}
+
+// findMilestone returns the number of the open milestone with the title and
+// true or false if there is no such milestone.
+func findMilestone(ctx context.Context, client *github.Client, repo Repository, title string) (int, bool, error) {
+	opts := &github.MilestoneListOptions{
+		State: "open",
+		ListOptions: github.ListOptions{
+			PerPage: 100,
+		},
+	}
+	for {
+		milestones, res, err := client.Issues.ListMilestones(ctx, repo.Owner, repo.Name, opts)
+		if err != nil {
+			return 0, false, fmt.Errorf("list milestones failed: %w", err)
+		}
+		for _, m := range milestones {
+			if m.GetTitle() == title {
+				return m.GetNumber(), true, nil
+			}
+		}
+		if res.NextPage == 0 {
+			break
+		}
+		opts.Page = res.NextPage
+	}
+	return 0, false, nil
+}
@@ -0,0 +1,135 @@
+package patch2pr
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-github/v89/github"
+)
+
+func TestAddPullRequestMetadata(t *testing.T) {
+	var reviewers, assignees bool
+	var milestone any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method + " " + r.URL.Path {
+		case "POST /repos/o/r/issues/1/labels":
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			fmt.Fprint(w, `{"message": "Validation Failed"}`)
+		case "POST /repos/o/r/pulls/1/requested_reviewers":
+			reviewers = true
+			w.WriteHeader(http.StatusCreated)
+			fmt.Fprint(w, `{"number": 1}`)
+		case "POST /repos/o/r/issues/1/assignees":
+			assignees = true
+			w.WriteHeader(http.StatusCreated)
+			fmt.Fprint(w, `{"number": 1}`)
+		case "GET /repos/o/r/milestones":
+			fmt.Fprint(w, `[{"number": 5, "title": "2024"}]`)
+		case "PATCH /repos/o/r/issues/1":
+			var req map[string]any
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				t.Errorf("invalid request: %v", err)
+			}
+			milestone = req["milestone"]
+			fmt.Fprint(w, `{"number": 1}`)
+		default:
+			t.Errorf("unexpected request: %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	client, err := github.NewClient(github.WithURLs(github.Ptr(srv.URL+"/"), nil))
+	if err != nil {
+		t.Fatalf("unexpected error creating client: %v", err)
+	}
+
+	md := PullRequestMetadata{
+		Labels:    []string{"missing-label"},
+		Reviewers: []string{"user"},
+		Assignees: []string{"user"},
+		Milestone: "2024",
+	}
+
+	err = AddPullRequestMetadata(t.Context(), client, Repository{Owner: "o", Name: "r"}, 1, md)
+
+	var merr *MetadataError
+	if !errors.As(err, &merr) {
+		t.Fatalf("expected metadata error, but got %v", err)
+	}
+	if len(merr.Failures) != 1 || merr.Failures["labels"] == nil {
+		t.Errorf("incorrect failures: want only labels, got %v", merr.Failures)
+	}
+
+	if !reviewers {
+		t.Error("reviewers were not requested after labels failed")
+	}
+	if !assignees {
+		t.Error("assignees were not added after labels failed")
+	}
+	if milestone != float64(5) {
+		t.Errorf("incorrect milestone: want 5, got %v", milestone)
+	}
+}
+
+func TestSetMilestone(t *testing.T) {
+	tests := map[string]struct {
+		Milestone string
+		Number    int
+		Error     bool
+	}{
+		"title":        {Milestone: "Next release", Number: 7},
+		"numericTitle": {Milestone: "2024", Number: 5},
+		"number":       {Milestone: "3", Number: 3},
+		"missingTitle": {Milestone: "Old release", Error: true},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			var number any
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch r.Method + " " + r.URL.Path {
+				case "GET /repos/o/r/milestones":
+					if state := r.URL.Query().Get("state"); state != "open" {
+						t.Errorf("incorrect milestone state: want open, got %q", state)
+					}
+					fmt.Fprint(w, `[{"number": 5, "title": "2024"}, {"number": 7, "title": "Next release"}]`)
+				case "PATCH /repos/o/r/issues/1":
+					var req map[string]any
+					if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+						t.Errorf("invalid request: %v", err)
+					}
+					number = req["milestone"]
+					fmt.Fprint(w, `{"number": 1}`)
+				default:
+					t.Errorf("unexpected request: %s %s", r.Method, r.URL.Path)
+					w.WriteHeader(http.StatusNotFound)
+				}
+			}))
+			defer srv.Close()
+
+			client, err := github.NewClient(github.WithURLs(github.Ptr(srv.URL+"/"), nil))
+			if err != nil {
+				t.Fatalf("unexpected error creating client: %v", err)
+			}
+
+			err = setMilestone(t.Context(), client, Repository{Owner: "o", Name: "r"}, 1, test.Milestone)
+			if test.Error {
+				if err == nil {
+					t.Fatal("expected error, but got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if number != float64(test.Number) {
+				t.Errorf("incorrect milestone: want %d, got %v", test.Number, number)
+			}
+		})
+	}
+}
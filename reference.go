@@ -6,14 +6,16 @@ import (
 	"strings"
 
 	"github.com/google/go-github/v89/github"
+	"github.com/shurcooL/githubv4"
 )
 
 // Reference is a named reference in a repository.
 type Reference struct {
-	client *github.Client
-	owner  string
-	repo   string
-	ref    string
+	client   *github.Client
+	v4client *githubv4.Client
+	owner    string
+	repo     string
+	ref      string
 }
 
 // NewReference creates a new Reference for ref in repo.
@@ -30,39 +32,244 @@ func NewReference(client *github.Client, repo Repository, ref string) *Reference
 	}
 }
 
+// SetV4Client sets a GraphQL API client used to make CompareAndSet updates
+// atomic. Without a V4 client, CompareAndSet checks the current value of the
+// reference before updating it, so concurrent forced updates may still race.
+func (r *Reference) SetV4Client(client *githubv4.Client) {
+	r.v4client = client
+}
+
 // Set creates or updates the reference to point to sha. If force is true and
 // the reference exists, Set updates it even if the update is not a
 // fast-forward.
 func (r *Reference) Set(ctx context.Context, sha string, force bool) error {
+	_, exists, err := r.get(ctx)
+	if err != nil {
+		return err
+	}
+
+	if exists {
+		return r.update(ctx, sha, force)
+	}
+	return r.create(ctx, sha)
+}
+
+// Get returns the SHA the reference points to and true if the reference
+// exists. If the reference does not exist, Get returns an empty string and
+// false.
+func (r *Reference) Get(ctx context.Context) (string, bool, error) {
+	return r.get(ctx)
+}
+
+// Exists returns true if the reference exists.
+func (r *Reference) Exists(ctx context.Context) (bool, error) {
+	_, exists, err := r.get(ctx)
+	return exists, err
+}
+
+// Delete deletes the reference. Deleting a reference that does not exist is
+// not an error.
+func (r *Reference) Delete(ctx context.Context) error {
+	if _, err := r.client.Git.DeleteRef(ctx, r.owner, r.repo, r.ref); err != nil {
+		// GitHub returns 422 instead of 404 for missing refs, so check if the
+		// ref exists to see if the deletion actually failed
+		if exists, getErr := r.Exists(ctx); getErr == nil && !exists {
+			return nil
+		}
+		return fmt.Errorf("delete ref failed: %w", err)
+	}
+	return nil
+}
+
+// ReferenceStatus describes the state of a branch reference.
+type ReferenceStatus struct {
+	// Exists is true if the reference exists.
+	Exists bool
+	// SHA is the commit the reference points to. Empty if it does not exist.
+	SHA string
+	// Protected is true if the branch has branch protection enabled. Protected
+	// is always false for branches that do not exist.
+	Protected bool
+	// PullRequests contains the numbers of open pull requests that use the
+	// branch as their head branch.
+	PullRequests []int
+}
+
+// Status returns the status of the reference, which must be a branch (start
+// with "refs/heads/".) Because pull requests from forks exist in the parent
+// repository, Status looks for open pull requests in prRepo, which may be
+// different from the repository that contains the reference.
+func (r *Reference) Status(ctx context.Context, prRepo Repository) (*ReferenceStatus, error) {
+	branch, ok := strings.CutPrefix(r.ref, "refs/heads/")
+	if !ok {
+		return nil, fmt.Errorf("reference %s is not a branch", r.ref)
+	}
+
+	sha, exists, err := r.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	status := &ReferenceStatus{Exists: exists, SHA: sha}
+	if !exists {
+		return status, nil
+	}
+
+	if status.Protected, err = r.Protected(ctx); err != nil {
+		return nil, err
+	}
+
+	opts := &github.PullRequestListOptions{
+		State: "open",
+		Head:  fmt.Sprintf("%s:%s", r.owner, branch),
+		ListOptions: github.ListOptions{
+			PerPage: 100,
+		},
+	}
+	for {
+		prs, res, err := r.client.PullRequests.List(ctx, prRepo.Owner, prRepo.Name, opts)
+		if err != nil {
+			return nil, fmt.Errorf("list pull requests failed: %w", err)
+		}
+		for _, pr := range prs {
+			status.PullRequests = append(status.PullRequests, pr.GetNumber())
+		}
+		if res.NextPage == 0 {
+			break
+		}
+		opts.Page = res.NextPage
+	}
+
+	return status, nil
+}
+
+// Protected returns true if the reference is a branch with branch protection
+// enabled. It returns false if the branch does not exist. Unlike Status,
+// Protected only makes a single request.
+func (r *Reference) Protected(ctx context.Context) (bool, error) {
+	branch, ok := strings.CutPrefix(r.ref, "refs/heads/")
+	if !ok {
+		return false, fmt.Errorf("reference %s is not a branch", r.ref)
+	}
+
+	// GetBranch does not return *github.ErrorResponse, so check the response
+	b, res, err := r.client.Repositories.GetBranch(ctx, r.owner, r.repo, branch, 0)
+	if err != nil {
+		if res != nil && res.StatusCode == 404 {
+			return false, nil
+		}
+		return false, fmt.Errorf("get branch failed: %w", err)
+	}
+	return b.GetProtected(), nil
+}
+
+// CompareAndSet updates the reference to point to sha only if it currently
+// points to expected. If expected is empty, CompareAndSet creates the
+// reference only if it does not exist. If force is true, CompareAndSet allows
+// updates that are not fast-forwards.
+//
+// If the current value of the reference does not match expected,
+// CompareAndSet returns an error of type *RefMismatchError.
+func (r *Reference) CompareAndSet(ctx context.Context, sha, expected string, force bool) error {
+	if expected == "" {
+		if err := r.create(ctx, sha); err != nil {
+			// Create returns 422 for many reasons, so confirm the ref exists
+			if current, exists, getErr := r.get(ctx); getErr == nil && exists {
+				return &RefMismatchError{Ref: r.ref, Actual: current}
+			}
+			return err
+		}
+		return nil
+	}
+
+	if r.v4client != nil {
+		return r.compareAndSetV4(ctx, sha, expected, force)
+	}
+
+	current, exists, err := r.get(ctx)
+	if err != nil {
+		return err
+	}
+	if !exists || current != expected {
+		return &RefMismatchError{Ref: r.ref, Expected: expected, Actual: current}
+	}
+	return r.update(ctx, sha, force)
+}
+
+func (r *Reference) compareAndSetV4(ctx context.Context, sha, expected string, force bool) error {
+	var q struct {
+		Repository struct {
+			ID string
+		} `graphql:"repository(owner: $owner, name: $name)"`
+	}
+	vars := map[string]any{
+		"owner": githubv4.String(r.owner),
+		"name":  githubv4.String(r.repo),
+	}
+	if err := r.v4client.Query(ctx, &q, vars); err != nil {
+		return fmt.Errorf("repository query failed: %w", err)
+	}
+
+	var m struct {
+		UpdateRefs struct {
+			ClientMutationID *string
+		} `graphql:"updateRefs(input: $input)"`
+	}
+	input := githubv4.UpdateRefsInput{
+		RepositoryID: githubv4.ID(q.Repository.ID),
+		RefUpdates: []githubv4.RefUpdate{{
+			Name:      githubv4.GitRefname(r.ref),
+			AfterOid:  githubv4.GitObjectID(sha),
+			BeforeOid: github.Ptr(githubv4.GitObjectID(expected)),
+			Force:     githubv4.NewBoolean(githubv4.Boolean(force)),
+		}},
+	}
+
+	if err := r.v4client.Mutate(ctx, &m, input, nil); err != nil {
+		// The mutation does not return a distinct error for a mismatch, so
+		// check if the ref changed to identify this case
+		if current, exists, getErr := r.get(ctx); getErr == nil && (!exists || current != expected) {
+			return &RefMismatchError{Ref: r.ref, Expected: expected, Actual: current}
+		}
+		return fmt.Errorf("update refs failed: %w", err)
+	}
+	return nil
+}
+
+// get returns the SHA the reference points to and true, or false if the
+// reference does not exist.
+func (r *Reference) get(ctx context.Context) (string, bool, error) {
 	// Test for existence because update and create return 422 responses if the
 	// the ref is missing or exists, respectively. The same code is also used
 	// for other errors like passing a bad SHA, so our only other option is to
 	// parse the string message, which is fragile.
-	var exists bool
-	if _, _, err := r.client.Git.GetRef(ctx, r.owner, r.repo, r.ref); err != nil {
+	ref, _, err := r.client.Git.GetRef(ctx, r.owner, r.repo, r.ref)
+	if err != nil {
 		if rerr, ok := err.(*github.ErrorResponse); !ok || rerr.Response.StatusCode != 404 {
-			return fmt.Errorf("get ref failed: %w", err)
+			return "", false, fmt.Errorf("get ref failed: %w", err)
 		}
-	} else {
-		exists = true
+		return "", false, nil
 	}
+	return ref.GetObject().GetSHA(), true, nil
+}
 
-	if exists {
-		if _, _, err := r.client.Git.UpdateRef(ctx, r.owner, r.repo, r.ref, github.UpdateRef{
-			SHA:   sha,
-			Force: github.Ptr(force),
-		}); err != nil {
-			return fmt.Errorf("update ref failed: %w", err)
-		}
-	} else {
-		if _, _, err := r.client.Git.CreateRef(ctx, r.owner, r.repo, github.CreateRef{
-			Ref: r.ref,
-			SHA: sha,
-		}); err != nil {
-			return fmt.Errorf("create ref failed: %w", err)
-		}
+func (r *Reference) update(ctx context.Context, sha string, force bool) error {
+	if _, _, err := r.client.Git.UpdateRef(ctx, r.owner, r.repo, r.ref, github.UpdateRef{
+		SHA:   sha,
+		Force: github.Ptr(force),
+	}); err != nil {
+		return fmt.Errorf("update ref failed: %w", err)
 	}
+	return nil
+}
 
+func (r *Reference) create(ctx context.Context, sha string) error {
+	if _, _, err := r.client.Git.CreateRef(ctx, r.owner, r.repo, github.CreateRef{
+		Ref: r.ref,
+		SHA: sha,
+	}); err != nil {
+		return fmt.Errorf("create ref failed: %w", err)
+	}
 	return nil
 }
 
@@ -0,0 +1,440 @@
+package patch2pr
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-github/v89/github"
+	"github.com/shurcooL/githubv4"
+)
+
+func TestReferenceProtected(t *testing.T) {
+	tests := map[string]struct {
+		Branch    string
+		Protected bool
+		Error     bool
+	}{
+		"protected":   {Branch: "main", Protected: true},
+		"unprotected": {Branch: "feature"},
+		"missing":     {Branch: "missing"},
+		"error":       {Branch: "error", Error: true},
+	}
+
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		switch r.URL.Path {
+		case "/repos/o/r/branches/main":
+			fmt.Fprint(w, `{"name": "main", "protected": true}`)
+		case "/repos/o/r/branches/feature":
+			fmt.Fprint(w, `{"name": "feature", "protected": false}`)
+		case "/repos/o/r/branches/error":
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprint(w, `{"message": "Server Error"}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"message": "Branch not found"}`)
+		}
+	}))
+	defer srv.Close()
+
+	client, err := github.NewClient(github.WithURLs(github.Ptr(srv.URL+"/"), nil))
+	if err != nil {
+		t.Fatalf("unexpected error creating client: %v", err)
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			requests = 0
+			ref := NewReference(client, Repository{Owner: "o", Name: "r"}, "refs/heads/"+test.Branch)
+
+			protected, err := ref.Protected(t.Context())
+			if test.Error {
+				if err == nil {
+					t.Fatal("expected error, but got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if protected != test.Protected {
+				t.Errorf("incorrect protected: want %t, got %t", test.Protected, protected)
+			}
+			if requests != 1 {
+				t.Errorf("incorrect number of requests: want 1, got %d", requests)
+			}
+		})
+	}
+
+	t.Run("notBranch", func(t *testing.T) {
+		ref := NewReference(client, Repository{Owner: "o", Name: "r"}, "refs/tags/v1")
+		if _, err := ref.Protected(t.Context()); err == nil {
+			t.Fatal("expected error, but got nil")
+		}
+	})
+}
+
+func TestReferenceCompareAndSetV4(t *testing.T) {
+	const (
+		expected = "1111111111111111111111111111111111111111"
+		other    = "2222222222222222222222222222222222222222"
+		sha      = "3333333333333333333333333333333333333333"
+	)
+
+	tests := map[string]struct {
+		Current  string
+		Force    bool
+		Fail     bool
+		Mismatch bool
+		Error    bool
+	}{
+		"success":  {Current: expected},
+		"force":    {Current: expected, Force: true},
+		"mismatch": {Current: other, Fail: true, Mismatch: true},
+		"error":    {Current: expected, Fail: true, Error: true},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			var update map[string]any
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path == "/repos/o/r/git/ref/heads/main" {
+					fmt.Fprintf(w, `{"ref": "refs/heads/main", "object": {"sha": %q}}`, test.Current)
+					return
+				}
+
+				var req struct {
+					Query     string
+					Variables struct {
+						Input map[string]any
+					}
+				}
+				if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+					t.Errorf("invalid request: %v", err)
+				}
+
+				switch {
+				case strings.HasPrefix(req.Query, "query"):
+					fmt.Fprint(w, `{"data": {"repository": {"id": "R_1"}}}`)
+				case test.Fail:
+					fmt.Fprint(w, `{"errors": [{"message": "ref update failed"}]}`)
+				default:
+					if updates, ok := req.Variables.Input["refUpdates"].([]any); ok && len(updates) == 1 {
+						update, _ = updates[0].(map[string]any)
+					}
+					fmt.Fprint(w, `{"data": {"updateRefs": {"clientMutationId": null}}}`)
+				}
+			}))
+			defer srv.Close()
+
+			client, err := github.NewClient(github.WithURLs(github.Ptr(srv.URL+"/"), nil))
+			if err != nil {
+				t.Fatalf("unexpected error creating client: %v", err)
+			}
+
+			ref := NewReference(client, Repository{Owner: "o", Name: "r"}, "refs/heads/main")
+			ref.SetV4Client(githubv4.NewEnterpriseClient(srv.URL+"/graphql", srv.Client()))
+
+			err = ref.CompareAndSet(t.Context(), sha, expected, test.Force)
+
+			var mismatch *RefMismatchError
+			switch {
+			case test.Mismatch:
+				if !errors.As(err, &mismatch) {
+					t.Fatalf("expected mismatch error, but got %v", err)
+				}
+				if mismatch.Expected != expected || mismatch.Actual != other {
+					t.Errorf("incorrect mismatch: want %s -> %s, got %s -> %s", expected, other, mismatch.Expected, mismatch.Actual)
+				}
+				return
+
+			case test.Error:
+				if err == nil {
+					t.Fatal("expected error, but got nil")
+				}
+				if errors.As(err, &mismatch) {
+					t.Fatalf("expected non-mismatch error, but got %v", err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			want := map[string]any{
+				"name":      "refs/heads/main",
+				"afterOid":  sha,
+				"beforeOid": expected,
+				"force":     test.Force,
+			}
+			for k, v := range want {
+				if update[k] != v {
+					t.Errorf("incorrect %s: want %v, got %v", k, v, update[k])
+				}
+			}
+		})
+	}
+}
+
+func TestReferenceGet(t *testing.T) {
+	const sha = "1111111111111111111111111111111111111111"
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/repos/o/r/git/ref/heads/main":
+			fmt.Fprintf(w, `{"ref": "refs/heads/main", "object": {"sha": %q}}`, sha)
+		case "/repos/o/r/git/ref/heads/error":
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprint(w, `{"message": "Server Error"}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"message": "Not Found"}`)
+		}
+	}))
+	defer srv.Close()
+
+	client, err := github.NewClient(github.WithURLs(github.Ptr(srv.URL+"/"), nil))
+	if err != nil {
+		t.Fatalf("unexpected error creating client: %v", err)
+	}
+
+	tests := map[string]struct {
+		Branch string
+		SHA    string
+		Exists bool
+		Error  bool
+	}{
+		"exists":  {Branch: "main", SHA: sha, Exists: true},
+		"missing": {Branch: "missing"},
+		"error":   {Branch: "error", Error: true},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			ref := NewReference(client, Repository{Owner: "o", Name: "r"}, "heads/"+test.Branch)
+
+			got, exists, err := ref.Get(t.Context())
+			if test.Error {
+				if err == nil {
+					t.Fatal("expected error, but got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != test.SHA || exists != test.Exists {
+				t.Errorf("incorrect ref: want %q, %t, got %q, %t", test.SHA, test.Exists, got, exists)
+			}
+
+			exists, err = ref.Exists(t.Context())
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if exists != test.Exists {
+				t.Errorf("incorrect exists: want %t, got %t", test.Exists, exists)
+			}
+		})
+	}
+}
+
+func TestReferenceDelete(t *testing.T) {
+	tests := map[string]struct {
+		Exists bool
+		Error  bool
+	}{
+		"missing":     {Exists: false},
+		"stillExists": {Exists: true, Error: true},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch r.Method + " " + r.URL.Path {
+				case "DELETE /repos/o/r/git/refs/heads/feature":
+					// GitHub returns 422 when deleting a missing ref
+					w.WriteHeader(http.StatusUnprocessableEntity)
+					fmt.Fprint(w, `{"message": "Reference does not exist"}`)
+				case "GET /repos/o/r/git/ref/heads/feature":
+					if !test.Exists {
+						w.WriteHeader(http.StatusNotFound)
+						fmt.Fprint(w, `{"message": "Not Found"}`)
+						return
+					}
+					fmt.Fprint(w, `{"ref": "refs/heads/feature", "object": {"sha": "1111111111111111111111111111111111111111"}}`)
+				default:
+					t.Errorf("unexpected request: %s %s", r.Method, r.URL.Path)
+					w.WriteHeader(http.StatusNotFound)
+				}
+			}))
+			defer srv.Close()
+
+			client, err := github.NewClient(github.WithURLs(github.Ptr(srv.URL+"/"), nil))
+			if err != nil {
+				t.Fatalf("unexpected error creating client: %v", err)
+			}
+
+			ref := NewReference(client, Repository{Owner: "o", Name: "r"}, "refs/heads/feature")
+			err = ref.Delete(t.Context())
+			if test.Error && err == nil {
+				t.Fatal("expected error, but got nil")
+			}
+			if !test.Error && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestReferenceStatus(t *testing.T) {
+	const sha = "1111111111111111111111111111111111111111"
+
+	tests := map[string]struct {
+		Branch string
+		Status ReferenceStatus
+	}{
+		"missing": {
+			Branch: "missing",
+			Status: ReferenceStatus{},
+		},
+		"pullRequests": {
+			Branch: "feature",
+			Status: ReferenceStatus{Exists: true, SHA: sha, Protected: true, PullRequests: []int{1, 2, 3}},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			var srv *httptest.Server
+			srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Path {
+				case "/repos/o/r/git/ref/heads/feature":
+					fmt.Fprintf(w, `{"ref": "refs/heads/feature", "object": {"sha": %q}}`, sha)
+				case "/repos/o/r/branches/feature":
+					fmt.Fprint(w, `{"name": "feature", "protected": true}`)
+				case "/repos/parent/r/pulls":
+					q := r.URL.Query()
+					if q.Get("head") != "o:feature" || q.Get("state") != "open" {
+						t.Errorf("incorrect pull request query: %s", r.URL.RawQuery)
+					}
+					if q.Get("page") == "2" {
+						fmt.Fprint(w, `[{"number": 3}]`)
+						return
+					}
+					w.Header().Set("Link", fmt.Sprintf(`<%s/repos/parent/r/pulls?page=2>; rel="next"`, srv.URL))
+					fmt.Fprint(w, `[{"number": 1}, {"number": 2}]`)
+				case "/repos/o/r/git/ref/heads/missing":
+					w.WriteHeader(http.StatusNotFound)
+					fmt.Fprint(w, `{"message": "Not Found"}`)
+				default:
+					t.Errorf("unexpected request: %s %s", r.Method, r.URL.Path)
+					w.WriteHeader(http.StatusNotFound)
+				}
+			}))
+			defer srv.Close()
+
+			client, err := github.NewClient(github.WithURLs(github.Ptr(srv.URL+"/"), nil))
+			if err != nil {
+				t.Fatalf("unexpected error creating client: %v", err)
+			}
+
+			ref := NewReference(client, Repository{Owner: "o", Name: "r"}, "refs/heads/"+test.Branch)
+			status, err := ref.Status(t.Context(), Repository{Owner: "parent", Name: "r"})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if status.Exists != test.Status.Exists || status.SHA != test.Status.SHA || status.Protected != test.Status.Protected {
+				t.Errorf("incorrect status:\nwant: %+v\n got: %+v", test.Status, *status)
+			}
+			if fmt.Sprint(status.PullRequests) != fmt.Sprint(test.Status.PullRequests) {
+				t.Errorf("incorrect pull requests: want %v, got %v", test.Status.PullRequests, status.PullRequests)
+			}
+		})
+	}
+}
+
+func TestReferenceCompareAndSet(t *testing.T) {
+	const (
+		expected = "1111111111111111111111111111111111111111"
+		other    = "2222222222222222222222222222222222222222"
+		sha      = "3333333333333333333333333333333333333333"
+	)
+
+	tests := map[string]struct {
+		Current  string
+		Expected string
+		Updated  bool
+		Mismatch bool
+	}{
+		"match":         {Current: expected, Expected: expected, Updated: true},
+		"mismatch":      {Current: other, Expected: expected, Mismatch: true},
+		"missing":       {Expected: expected, Mismatch: true},
+		"createExists":  {Current: other, Mismatch: true},
+		"createMissing": {Updated: true},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			var updated bool
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch r.Method + " " + r.URL.Path {
+				case "GET /repos/o/r/git/ref/heads/main":
+					if test.Current == "" {
+						w.WriteHeader(http.StatusNotFound)
+						fmt.Fprint(w, `{"message": "Not Found"}`)
+						return
+					}
+					fmt.Fprintf(w, `{"ref": "refs/heads/main", "object": {"sha": %q}}`, test.Current)
+				case "PATCH /repos/o/r/git/refs/heads/main":
+					updated = true
+					fmt.Fprintf(w, `{"ref": "refs/heads/main", "object": {"sha": %q}}`, sha)
+				case "POST /repos/o/r/git/refs":
+					if test.Current != "" {
+						w.WriteHeader(http.StatusUnprocessableEntity)
+						fmt.Fprint(w, `{"message": "Reference already exists"}`)
+						return
+					}
+					updated = true
+					w.WriteHeader(http.StatusCreated)
+					fmt.Fprintf(w, `{"ref": "refs/heads/main", "object": {"sha": %q}}`, sha)
+				default:
+					t.Errorf("unexpected request: %s %s", r.Method, r.URL.Path)
+					w.WriteHeader(http.StatusNotFound)
+				}
+			}))
+			defer srv.Close()
+
+			client, err := github.NewClient(github.WithURLs(github.Ptr(srv.URL+"/"), nil))
+			if err != nil {
+				t.Fatalf("unexpected error creating client: %v", err)
+			}
+
+			ref := NewReference(client, Repository{Owner: "o", Name: "r"}, "refs/heads/main")
+			err = ref.CompareAndSet(t.Context(), sha, test.Expected, false)
+
+			if test.Mismatch {
+				var mismatch *RefMismatchError
+				if !errors.As(err, &mismatch) {
+					t.Fatalf("expected mismatch error, but got %v", err)
+				}
+				if mismatch.Expected != test.Expected || mismatch.Actual != test.Current {
+					t.Errorf("incorrect mismatch: want %q -> %q, got %q -> %q", test.Expected, test.Current, mismatch.Expected, mismatch.Actual)
+				}
+			} else if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if updated != test.Updated {
+				t.Errorf("incorrect update: want %t, got %t", test.Updated, updated)
+			}
+		})
+	}
+}
@@ -0,0 +1,195 @@
+package patch2pr
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/bluekeyes/go-gitdiff/gitdiff"
+)
+
+// SeriesEntry is a patch listed in a quilt series file.
+type SeriesEntry struct {
+	// Name is the path of the patch file relative to the directory that
+	// contains the series file.
+	Name string
+
+	// StripLevel is the number of leading components to remove from the file
+	// names in the patch, like the -p option of patch. The default is 1.
+	StripLevel int
+}
+
+// SeriesPatch is a parsed patch from a quilt series.
+type SeriesPatch struct {
+	SeriesEntry
+
+	// Files are the changed files with names adjusted for the strip level.
+	Files []*gitdiff.File
+
+	// Header is the parsed patch header, or nil if the patch has no header.
+	Header *gitdiff.PatchHeader
+}
+
+// ParseSeries parses a quilt series file. Each line names a patch file and
+// may set the strip level with a -pN option. Blank lines and text after a '#'
+// are ignored.
+func ParseSeries(r io.Reader) ([]SeriesEntry, error) {
+	var entries []SeriesEntry
+
+	s := bufio.NewScanner(r)
+	for lineno := 1; s.Scan(); lineno++ {
+		line := s.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		entry := SeriesEntry{Name: fields[0], StripLevel: 1}
+		for i := 1; i < len(fields); i++ {
+			opt := fields[i]
+			switch {
+			case opt == "-p" && i+1 < len(fields):
+				i++
+				opt = "-p" + fields[i]
+				fallthrough
+			case strings.HasPrefix(opt, "-p"):
+				n, err := strconv.Atoi(opt[2:])
+				if err != nil || n < 0 {
+					return nil, fmt.Errorf("series line %d: invalid strip level %q", lineno, opt)
+				}
+				entry.StripLevel = n
+			default:
+				return nil, fmt.Errorf("series line %d: unsupported option %q", lineno, opt)
+			}
+		}
+		entries = append(entries, entry)
+	}
+	if err := s.Err(); err != nil {
+		return nil, fmt.Errorf("read series failed: %w", err)
+	}
+	return entries, nil
+}
+
+// ReadSeries reads the quilt series file with the given name from fsys and
+// parses each patch it lists, in order. Patch names are relative to the
+// directory that contains the series file. Parsing a Git diff always removes
+// the "a/" and "b/" prefixes, so ReadSeries returns an error if a Git diff has
+// a strip level of 0.
+func ReadSeries(fsys fs.FS, name string) ([]SeriesPatch, error) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("open series failed: %w", err)
+	}
+	defer f.Close()
+
+	entries, err := ParseSeries(f)
+	if err != nil {
+		return nil, err
+	}
+
+	dir := path.Dir(name)
+
+	patches := make([]SeriesPatch, len(entries))
+	for i, entry := range entries {
+		content, err := fs.ReadFile(fsys, path.Join(dir, entry.Name))
+		if err != nil {
+			return nil, fmt.Errorf("read patch %s failed: %w", entry.Name, err)
+		}
+
+		files, preamble, err := gitdiff.Parse(bytes.NewReader(content))
+		if err != nil {
+			return nil, fmt.Errorf("parse patch %s failed: %w", entry.Name, err)
+		}
+
+		// gitdiff removes the "a/" and "b/" prefixes from Git diffs, which is
+		// the same as one level of stripping
+		level := entry.StripLevel
+		if isGitDiff(content) {
+			if level == 0 {
+				return nil, fmt.Errorf("patch %s: strip level 0 is not supported for Git diffs", entry.Name)
+			}
+			level--
+		}
+		if err := StripPrefix(files, level); err != nil {
+			return nil, fmt.Errorf("patch %s: %w", entry.Name, err)
+		}
+
+		patches[i] = SeriesPatch{
+			SeriesEntry: entry,
+			Files:       files,
+			Header:      parseSeriesHeader(preamble),
+		}
+	}
+	return patches, nil
+}
+
+// parseSeriesHeader parses the header of a patch in a series. Quilt patches
+// often start with a free-form description instead of an email or commit
+// header, so if the header is not in a format gitdiff recognizes, the first
+// line is the title and the remaining lines are the body.
+func parseSeriesHeader(preamble string) *gitdiff.PatchHeader {
+	preamble = strings.TrimSpace(preamble)
+	if preamble == "" {
+		return nil
+	}
+	if h, err := gitdiff.ParsePatchHeader(preamble); err == nil {
+		return h
+	}
+
+	title, body, _ := strings.Cut(preamble, "\n")
+	return &gitdiff.PatchHeader{
+		Title: strings.TrimSpace(title),
+		Body:  strings.TrimSpace(body),
+	}
+}
+
+// StripPrefix removes n leading path components from the names of files, like
+// the -p option of patch. It returns an error if a name has n or fewer
+// components.
+func StripPrefix(files []*gitdiff.File, n int) error {
+	if n <= 0 {
+		return nil
+	}
+	for _, f := range files {
+		var err error
+		if f.OldName, err = stripName(f.OldName, n); err != nil {
+			return err
+		}
+		if f.NewName, err = stripName(f.NewName, n); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func stripName(name string, n int) (string, error) {
+	if name == "" {
+		return "", nil
+	}
+
+	stripped := strings.TrimLeft(name, "/")
+	for range n {
+		i := strings.IndexByte(stripped, '/')
+		if i < 0 {
+			return "", fmt.Errorf("cannot remove %d leading components from %q", n, name)
+		}
+		stripped = strings.TrimLeft(stripped[i+1:], "/")
+	}
+	if stripped == "" {
+		return "", fmt.Errorf("cannot remove %d leading components from %q", n, name)
+	}
+	return stripped, nil
+}
+
+func isGitDiff(content []byte) bool {
+	return bytes.HasPrefix(content, []byte("diff --git ")) || bytes.Contains(content, []byte("\ndiff --git "))
+}
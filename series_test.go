@@ -0,0 +1,143 @@
+package patch2pr
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestParseSeries(t *testing.T) {
+	series := `# Patches for the next release
+fix-build.patch
+add-feature.diff -p0
+
+docs/update-readme.patch -p 2 # moved from another series
+`
+
+	entries, err := ParseSeries(strings.NewReader(series))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []SeriesEntry{
+		{Name: "fix-build.patch", StripLevel: 1},
+		{Name: "add-feature.diff", StripLevel: 0},
+		{Name: "docs/update-readme.patch", StripLevel: 2},
+	}
+	if !reflect.DeepEqual(want, entries) {
+		t.Errorf("incorrect entries:\nwant: %+v\n got: %+v", want, entries)
+	}
+
+	for _, invalid := range []string{"fix.patch -R", "fix.patch -px", "fix.patch -p -1"} {
+		if _, err := ParseSeries(strings.NewReader(invalid)); err == nil {
+			t.Errorf("expected error for %q, but got nil", invalid)
+		}
+	}
+}
+
+func TestReadSeries(t *testing.T) {
+	fsys := fstest.MapFS{
+		"patches/series": {Data: []byte("traditional.patch\ngit.patch\nnoprefix.patch -p0\n")},
+		"patches/traditional.patch": {Data: []byte(`Fix the greeting
+
+--- project.orig/src/hello.txt
++++ project/src/hello.txt
+@@ -1 +1 @@
+-hello
++hello, world
+`)},
+		"patches/git.patch": {Data: []byte(`From 5255ca3071e33871ad7c23de1a3962f19b215f74 Mon Sep 17 00:00:00 2001
+From: Test <test@example.com>
+Subject: [PATCH] Update the greeting
+
+---
+diff --git a/src/hello.txt b/src/hello.txt
+--- a/src/hello.txt
++++ b/src/hello.txt
+@@ -1 +1 @@
+-hello, world
++hello, everyone
+`)},
+		"patches/noprefix.patch": {Data: []byte(`--- src/hello.txt
++++ src/hello.txt
+@@ -1 +1 @@
+-hello, everyone
++hi, everyone
+`)},
+	}
+
+	patches, err := ReadSeries(fsys, "patches/series")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(patches) != 3 {
+		t.Fatalf("incorrect number of patches: want 3, got %d", len(patches))
+	}
+
+	for i, p := range patches {
+		if len(p.Files) != 1 {
+			t.Fatalf("patch %d: incorrect number of files: want 1, got %d", i, len(p.Files))
+		}
+		if got := p.Files[0].NewName; got != "src/hello.txt" {
+			t.Errorf("patch %d: incorrect file name: want %q, got %q", i, "src/hello.txt", got)
+		}
+	}
+
+	if h := patches[0].Header; h == nil || h.Title != "Fix the greeting" {
+		t.Errorf("patch 0: incorrect header: %+v", h)
+	}
+	if h := patches[1].Header; h == nil || h.Title != "Update the greeting" {
+		t.Errorf("patch 1: incorrect header: %+v", h)
+	}
+	if h := patches[2].Header; h != nil {
+		t.Errorf("patch 2: expected nil header, got %+v", h)
+	}
+}
+
+func TestReadSeriesGitDiffNoStrip(t *testing.T) {
+	fsys := fstest.MapFS{
+		"series": {Data: []byte("git.patch -p0\n")},
+		"git.patch": {Data: []byte(`diff --git a/src/hello.txt b/src/hello.txt
+--- a/src/hello.txt
++++ b/src/hello.txt
+@@ -1 +1 @@
+-hello
++hello, world
+`)},
+	}
+
+	if _, err := ReadSeries(fsys, "series"); err == nil {
+		t.Fatal("expected error for Git diff with -p0, but got nil")
+	}
+}
+
+func TestStripPrefix(t *testing.T) {
+	for i, tc := range []struct {
+		Name  string
+		Level int
+		Want  string
+		Err   bool
+	}{
+		{Name: "a/b/c.txt", Level: 1, Want: "b/c.txt"},
+		{Name: "a//b/c.txt", Level: 2, Want: "c.txt"},
+		{Name: "a/b/c.txt", Level: 0, Want: "a/b/c.txt"},
+		{Name: "c.txt", Level: 1, Err: true},
+		{Name: "a/b/", Level: 2, Err: true},
+	} {
+		got, err := stripName(tc.Name, tc.Level)
+		if tc.Err {
+			if err == nil {
+				t.Errorf("case %d: expected error, but got nil", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("case %d: unexpected error: %v", i, err)
+			continue
+		}
+		if got != tc.Want {
+			t.Errorf("case %d: want %q, got %q", i, tc.Want, got)
+		}
+	}
+}
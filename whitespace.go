@@ -0,0 +1,204 @@
+package patch2pr
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/bluekeyes/go-gitdiff/gitdiff"
+)
+
+// WhitespaceMode controls how appliers handle whitespace errors in the lines
+// added by a patch, like the --whitespace option of 'git apply'. Whitespace
+// errors are trailing whitespace and blank lines added at the end of a file.
+type WhitespaceMode int
+
+const (
+	// WhitespaceNoWarn applies added lines without checking for errors.
+	WhitespaceNoWarn WhitespaceMode = iota
+
+	// WhitespaceWarn applies added lines without changes and reports errors.
+	WhitespaceWarn
+
+	// WhitespaceFix removes trailing whitespace from added lines and removes
+	// blank lines added at the end of a file, and reports what it removed.
+	WhitespaceFix
+
+	// WhitespaceError fails to apply files that add lines with errors.
+	WhitespaceError
+)
+
+// WhitespaceReport counts the whitespace problems in a file.
+type WhitespaceReport struct {
+	// The path to the file.
+	File string
+	// The number of added lines with trailing whitespace.
+	TrailingWhitespace int
+	// The number of blank lines added at the end of the file.
+	BlankAtEOF int
+	// The number of context lines that matched the file only after ignoring
+	// whitespace.
+	IgnoredContext int
+	// True if the trailing whitespace and blank lines were removed.
+	Fixed bool
+}
+
+// String describes the problems in the file, like "file.txt: added 2 lines
+// with trailing whitespace".
+func (r WhitespaceReport) String() string {
+	var parts []string
+	if r.hasErrors() {
+		var problems []string
+		if n := r.TrailingWhitespace; n > 0 {
+			problems = append(problems, fmt.Sprintf("%d %s with trailing whitespace", n, pluralize(n, "line", "lines")))
+		}
+		if n := r.BlankAtEOF; n > 0 {
+			problems = append(problems, fmt.Sprintf("%d blank %s at end of file", n, pluralize(n, "line", "lines")))
+		}
+
+		action := "added"
+		if r.Fixed {
+			action = "fixed"
+		}
+		parts = append(parts, action+" "+strings.Join(problems, " and "))
+	}
+	if n := r.IgnoredContext; n > 0 {
+		parts = append(parts, fmt.Sprintf("ignored whitespace in %d context %s", n, pluralize(n, "line", "lines")))
+	}
+	return r.File + ": " + strings.Join(parts, ", ")
+}
+
+func pluralize(n int, singular, plural string) string {
+	if n == 1 {
+		return singular
+	}
+	return plural
+}
+
+func (r WhitespaceReport) hasErrors() bool {
+	return r.TrailingWhitespace > 0 || r.BlankAtEOF > 0
+}
+
+func (r WhitespaceReport) isEmpty() bool {
+	return !r.hasErrors() && r.IgnoredContext == 0
+}
+
+// checkWhitespace finds whitespace errors in the lines that f adds to src. If
+// mode is WhitespaceFix, it returns a copy of f without the errors.
+func checkWhitespace(src []byte, f *gitdiff.File, name string, mode WhitespaceMode) (*gitdiff.File, WhitespaceReport) {
+	report := WhitespaceReport{File: name}
+	if mode == WhitespaceNoWarn || f.IsBinary || len(f.TextFragments) == 0 {
+		return f, report
+	}
+
+	srcLines := int64(len(splitLines(src)))
+	fix := mode == WhitespaceFix
+
+	frags := make([]*gitdiff.TextFragment, len(f.TextFragments))
+	for i, frag := range f.TextFragments {
+		fixed := *frag
+		fixed.Lines = make([]gitdiff.Line, len(frag.Lines))
+		copy(fixed.Lines, frag.Lines)
+
+		// Blank lines at the end only count as blank, not as trailing space
+		end := len(fixed.Lines)
+		if reachesEOF(frag, srcLines) {
+			blank := blankAtEnd(fixed.Lines)
+			report.BlankAtEOF += blank
+			end -= blank
+			if fix && blank > 0 {
+				fixed.Lines = fixed.Lines[:end]
+				fixed.NewLines -= int64(blank)
+				fixed.LinesAdded -= int64(blank)
+				updateContext(&fixed)
+			}
+		}
+
+		for j, line := range fixed.Lines[:end] {
+			if line.Op != gitdiff.OpAdd {
+				continue
+			}
+			if trimmed, ok := trimTrailingSpace(line.Line); ok {
+				report.TrailingWhitespace++
+				if fix {
+					fixed.Lines[j].Line = trimmed
+				}
+			}
+		}
+		frags[i] = &fixed
+	}
+
+	if !fix || !report.hasErrors() {
+		return f, report
+	}
+
+	report.Fixed = true
+	fixedFile := *f
+	fixedFile.TextFragments = frags
+	return &fixedFile, report
+}
+
+// reachesEOF returns true if frag ends at the end of a file with n lines and
+// does not have trailing context.
+func reachesEOF(frag *gitdiff.TextFragment, n int64) bool {
+	if frag.TrailingContext > 0 {
+		return false
+	}
+	if frag.OldPosition == 0 {
+		return n == 0
+	}
+	return frag.OldPosition-1+frag.OldLines == n
+}
+
+// updateContext sets the leading and trailing context counts of frag from
+// its lines.
+func updateContext(frag *gitdiff.TextFragment) {
+	frag.LeadingContext, frag.TrailingContext = 0, 0
+
+	changed := false
+	for _, line := range frag.Lines {
+		switch {
+		case line.Op != gitdiff.OpContext:
+			changed = true
+			frag.TrailingContext = 0
+		case changed:
+			frag.TrailingContext++
+		default:
+			frag.LeadingContext++
+		}
+	}
+}
+
+// blankAtEnd returns the number of blank added lines at the end of lines.
+func blankAtEnd(lines []gitdiff.Line) int {
+	n := 0
+	for i := len(lines) - 1; i >= 0; i-- {
+		if lines[i].Op != gitdiff.OpAdd || strings.TrimSpace(lines[i].Line) != "" {
+			break
+		}
+		n++
+	}
+	return n
+}
+
+// trimTrailingSpace removes spaces and tabs before the line ending of line. It
+// returns false if there were none.
+func trimTrailingSpace(line string) (string, bool) {
+	content, eol := splitLineEnding(line)
+	trimmed := strings.TrimRight(content, " \t")
+	if trimmed == content {
+		return line, false
+	}
+	return trimmed + eol, true
+}
+
+// splitLineEnding splits line into its content and its line ending, which may
+// be empty.
+func splitLineEnding(line string) (string, string) {
+	switch {
+	case strings.HasSuffix(line, "\r\n"):
+		return line[:len(line)-2], "\r\n"
+	case strings.HasSuffix(line, "\n"):
+		return line[:len(line)-1], "\n"
+	}
+	return line, ""
+}
@@ -0,0 +1,137 @@
+package patch2pr
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/bluekeyes/go-gitdiff/gitdiff"
+)
+
+func TestCheckWhitespace(t *testing.T) {
+	const src = "one\ntwo\nthree\n"
+
+	tests := map[string]struct {
+		Patch  string
+		Mode   WhitespaceMode
+		Report WhitespaceReport
+		Result string
+		Error  bool
+	}{
+		"noWarn": {
+			Patch:  "@@ -2,2 +2,2 @@\n two\n-three\n+THREE \n",
+			Mode:   WhitespaceNoWarn,
+			Report: WhitespaceReport{File: "file.txt"},
+			Result: "one\ntwo\nTHREE \n",
+		},
+		"warn": {
+			Patch:  "@@ -2,2 +2,2 @@\n two\n-three\n+THREE \n",
+			Mode:   WhitespaceWarn,
+			Report: WhitespaceReport{File: "file.txt", TrailingWhitespace: 1},
+			Result: "one\ntwo\nTHREE \n",
+		},
+		"fix": {
+			Patch:  "@@ -1,3 +1,4 @@\n one\n+one.5\t \n two\n-three\n+THREE  \n",
+			Mode:   WhitespaceFix,
+			Report: WhitespaceReport{File: "file.txt", TrailingWhitespace: 2, Fixed: true},
+			Result: "one\none.5\ntwo\nTHREE\n",
+		},
+		"fixContextUnchanged": {
+			Patch:  "@@ -1,3 +1,3 @@\n one\n-two\n+TWO\n three\n",
+			Mode:   WhitespaceFix,
+			Report: WhitespaceReport{File: "file.txt"},
+			Result: "one\nTWO\nthree\n",
+		},
+		"fixBlankAtEOF": {
+			Patch:  "@@ -3 +3,4 @@\n three\n+four \n+\n+  \n",
+			Mode:   WhitespaceFix,
+			Report: WhitespaceReport{File: "file.txt", TrailingWhitespace: 1, BlankAtEOF: 2, Fixed: true},
+			Result: "one\ntwo\nthree\nfour\n",
+		},
+		"blankNotAtEOF": {
+			Patch:  "@@ -1,2 +1,3 @@\n one\n+\n two\n",
+			Mode:   WhitespaceFix,
+			Report: WhitespaceReport{File: "file.txt"},
+			Result: "one\n\ntwo\nthree\n",
+		},
+		"error": {
+			Patch:  "@@ -3 +3,2 @@\n three\n+\n",
+			Mode:   WhitespaceError,
+			Report: WhitespaceReport{File: "file.txt", BlankAtEOF: 1},
+			Error:  true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			patch := "diff --git a/file.txt b/file.txt\n--- a/file.txt\n+++ b/file.txt\n" + test.Patch
+			files, _, err := gitdiff.Parse(strings.NewReader(patch))
+			if err != nil {
+				t.Fatalf("unexpected error parsing patch: %v", err)
+			}
+
+			adjusted, err := adjustFile([]byte(src), files[0], "file.txt", lineEndingNone, matchOptions{}, test.Mode)
+			if test.Error {
+				var wsErr *BadWhitespaceError
+				if !errors.As(err, &wsErr) {
+					t.Fatalf("expected whitespace error, but got %v", err)
+				}
+				if wsErr.WhitespaceReport != test.Report {
+					t.Errorf("incorrect report:\nwant: %+v\n got: %+v", test.Report, wsErr.WhitespaceReport)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if adjusted.report != test.Report {
+				t.Errorf("incorrect report:\nwant: %+v\n got: %+v", test.Report, adjusted.report)
+			}
+
+			b, err := adjusted.apply("file.txt")
+			if err != nil {
+				t.Fatalf("unexpected error applying patch: %v", err)
+			}
+			if got := string(b); got != test.Result {
+				t.Errorf("incorrect result:\nwant: %q\n got: %q", test.Result, got)
+			}
+		})
+	}
+}
+
+func TestWhitespaceReportString(t *testing.T) {
+	tests := map[string]struct {
+		Report   WhitespaceReport
+		Expected string
+	}{
+		"added": {
+			Report:   WhitespaceReport{File: "file.txt", TrailingWhitespace: 2, BlankAtEOF: 1},
+			Expected: "file.txt: added 2 lines with trailing whitespace and 1 blank line at end of file",
+		},
+		"fixed": {
+			Report:   WhitespaceReport{File: "file.txt", TrailingWhitespace: 1, Fixed: true},
+			Expected: "file.txt: fixed 1 line with trailing whitespace",
+		},
+		"ignoredContext": {
+			Report:   WhitespaceReport{File: "file.txt", IgnoredContext: 3},
+			Expected: "file.txt: ignored whitespace in 3 context lines",
+		},
+		"both": {
+			Report:   WhitespaceReport{File: "file.txt", BlankAtEOF: 2, IgnoredContext: 1},
+			Expected: "file.txt: added 2 blank lines at end of file, ignored whitespace in 1 context line",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := test.Report.String(); got != test.Expected {
+				t.Errorf("incorrect string:\nwant: %q\n got: %q", test.Expected, got)
+			}
+		})
+	}
+
+	err := &BadWhitespaceError{WhitespaceReport: tests["added"].Report}
+	if want := "whitespace error: " + tests["added"].Expected; err.Error() != want {
+		t.Errorf("incorrect error:\nwant: %q\n got: %q", want, err.Error())
+	}
+}